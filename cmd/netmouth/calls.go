@@ -0,0 +1,424 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"babylon/internal/rtp"
+	"babylon/internal/sdp"
+	"babylon/internal/service"
+	"babylon/internal/tts"
+
+	"github.com/percivalalb/sipuri"
+
+	osip "babylon/internal/exosip2"
+)
+
+// announcement call in progress
+type Call struct {
+	cid     int
+	did     int
+	item    announcement
+	media   *rtp.Session
+	started bool
+	digits  chan string
+	pressed string
+	inbound bool
+	hops    int
+	done    chan struct{} // closed when an outbound call ends
+}
+
+// plays tts output into a call
+type callPlayer struct {
+	call   *Call
+	volume float64
+}
+
+var (
+	calls    = make(map[int]*Call)
+	callLock sync.Mutex
+	latest   announcement
+
+	errInterrupted = errors.New("interrupted by caller")
+)
+
+// redirects followed for an outbound call
+const maxHops = 3
+
+// decode speech and downsample to 8khz for g.711
+func (player *callPlayer) Play(fileName string) error {
+	speech, err := tts.Decode(fileName)
+	if err != nil {
+		return err
+	}
+	audio := tts.Gain(speech.Resample(8000), player.volume)
+
+	// write a frame at a time so caller digits can interrupt
+	call := player.call
+	samples := call.media.Samples()
+	for pos := 0; pos < len(audio); pos += samples {
+		select {
+		case call.pressed = <-call.digits:
+			return errInterrupted
+		default:
+		}
+		end := pos + samples
+		if end > len(audio) {
+			end = len(audio)
+		}
+		err = call.media.Write(audio[pos:end])
+		if err != nil {
+			return err
+		}
+	}
+	return call.media.Flush()
+}
+
+// local address used to reach a remote host, public if behind nat
+func localAddress(ctx osip.Agent, remote string) string {
+	config := current()
+	public, _, err := net.SplitHostPort(ctx.Snapshot().Public)
+	if err == nil {
+		ip := net.ParseIP(remote)
+		if ip == nil || !(ip.IsPrivate() || ip.IsLoopback()) {
+			return public
+		}
+	}
+
+	if len(config.Host) > 0 && !net.ParseIP(config.Host).IsUnspecified() {
+		return config.Host
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(remote, "9"))
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// remember latest announcement for inbound callers
+func setLatest(item announcement) {
+	callLock.Lock()
+	defer callLock.Unlock()
+	latest = item
+}
+
+func getLatest() announcement {
+	config := current()
+	callLock.Lock()
+	defer callLock.Unlock()
+	if len(latest.Text) < 1 {
+		return announcement{Text: config.Greeting}
+	}
+	return latest
+}
+
+func addCall(call *Call) {
+	callLock.Lock()
+	defer callLock.Unlock()
+	calls[call.cid] = call
+}
+
+func findCall(cid int) *Call {
+	callLock.Lock()
+	defer callLock.Unlock()
+	return calls[cid]
+}
+
+// answer an inbound call to hear the latest announcement
+func answerCall(event *osip.Event) {
+	config := current()
+	ctx := event.Context
+	if event.Content != sdp.ContentType {
+		event.Reply(osip.SIP_NOT_ACCEPTABLE_HERE)
+		return
+	}
+
+	offer, err := sdp.Parse(event.Body)
+	if err != nil {
+		service.Debug(2, "invalid offer from ", event.From, "; ", err)
+		event.Reply(osip.SIP_NOT_ACCEPTABLE_HERE)
+		return
+	}
+
+	audio := offer.Audio()
+	codec, err := sdp.Negotiate(audio, sdp.G711)
+	if err != nil {
+		event.Reply(osip.SIP_NOT_ACCEPTABLE_HERE)
+		return
+	}
+
+	dtmf := -1
+	if events, ok := sdp.Events(audio, sdp.Audio); ok {
+		dtmf = events.Payload
+	}
+	media, err := rtp.New(rtp.Config{Host: config.Host, Payload: codec.Payload, Dtmf: dtmf})
+	if err != nil {
+		service.Error(err)
+		event.Reply(osip.SIP_SERVICE_UNAVAILABLE)
+		return
+	}
+
+	remote := offer.Address(audio)
+	local := localAddress(ctx, remote)
+	answer, err := offer.Answer(sdp.NewOrigin("netmouth", local), local, media.Port, sdp.Audio)
+	if err == nil {
+		err = media.Connect(remote, audio.Port)
+	}
+	if err == nil {
+		err = ctx.Answer(event.Tran, osip.SIP_OK, sdp.ContentType, answer.Marshal())
+	}
+	if err != nil {
+		service.Error(err)
+		media.Close()
+		event.Reply(osip.SIP_SERVICE_UNAVAILABLE)
+		return
+	}
+
+	service.Debug(2, "answered call from ", event.From)
+	call := newCall(event.Call, event.Dialog, getLatest(), media, nil)
+	call.inbound = true
+	addCall(call)
+}
+
+// place an outbound call to speak an announcement, done is closed when
+// the call and any redirects of it have ended
+func dialCall(ctx osip.Agent, to string, item announcement, hops int, done chan struct{}) error {
+	config := current()
+	host := "localhost"
+	route, err := sipuri.Parse(config.route)
+	if err == nil {
+		host = route.Host()
+	}
+
+	media, err := rtp.New(rtp.Config{Host: config.Host})
+	if err != nil {
+		return err
+	}
+
+	local := localAddress(ctx, host)
+	offer := sdp.Offer(sdp.NewOrigin("netmouth", local), local, media.Port, sdp.Audio)
+	callLock.Lock()
+	defer callLock.Unlock()
+	cid, err := ctx.Invite(to, "", sdp.ContentType, offer.Marshal())
+	if err != nil {
+		media.Close()
+		return err
+	}
+	call := newCall(cid, -1, item, media, done)
+	call.hops = hops
+	calls[cid] = call
+	return nil
+}
+
+// follow the first contact of a redirected outbound call
+func redirectCall(event *osip.Event) {
+	callLock.Lock()
+	call, ok := calls[event.Call]
+	delete(calls, event.Call)
+	callLock.Unlock()
+	if !ok {
+		return
+	}
+
+	call.media.Close()
+	contacts := event.Contacts()
+	if len(contacts) < 1 || call.hops >= maxHops {
+		service.Warn("call redirect failed; status=", event.Status)
+		call.end()
+		return
+	}
+	to := contactUri(contacts[0])
+	service.Debug(2, "call redirected to ", to)
+	err := dialCall(event.Context, to, call.item, call.hops+1, call.done)
+	if err != nil {
+		service.Error(err)
+		call.end()
+	}
+}
+
+// uri of a contact header value
+func contactUri(contact string) string {
+	if start := strings.IndexByte(contact, '<'); start > -1 {
+		contact = contact[start+1:]
+		if end := strings.IndexByte(contact, '>'); end > -1 {
+			return contact[:end]
+		}
+	}
+	return strings.TrimSpace(strings.SplitN(contact, ";", 2)[0])
+}
+
+// hangup once a transfer to the operator completes or fails
+func transferCall(event *osip.Event) {
+	call := findCall(event.Call)
+	if call == nil {
+		return
+	}
+
+	service.Debug(2, "call transfer; method=", event.Method, ", status=", event.Status)
+	if event.Status >= 300 || (event.Method == "NOTIFY" && event.Status >= 200) {
+		event.Context.Hangup(call.cid, call.did)
+	}
+}
+
+func newCall(cid, did int, item announcement, media *rtp.Session, done chan struct{}) *Call {
+	return &Call{cid: cid, did: did, item: item, media: media, digits: make(chan string, 1), done: done}
+}
+
+// signal the dialer once a call is removed from calls
+func (call *Call) end() {
+	if call.done != nil {
+		close(call.done)
+	}
+}
+
+// caller pressed a digit, from sip info or rtp telephone events
+func pressCall(cid int, digit string) {
+	call := findCall(cid)
+	if call == nil {
+		return
+	}
+	call.press(digit)
+}
+
+func (call *Call) press(digit string) {
+	config := current()
+	switch digit {
+	case config.Repeat, config.Skip, config.Stop:
+		select {
+		case call.digits <- digit:
+		default:
+		}
+	}
+}
+
+// start speaking once call media is connected
+func startCall(event *osip.Event) {
+	call := findCall(event.Call)
+	if call == nil || call.started {
+		return
+	}
+
+	call.did = event.Dialog
+	if event.Type == osip.EVT_CALL_ANSWERED {
+		err := call.connect(event.Body)
+		if err != nil {
+			service.Error(fmt.Errorf("call media failed; %v", err))
+			event.Context.Hangup(call.cid, call.did)
+			return
+		}
+	}
+
+	call.started = true
+	go call.listen()
+	go call.speak(event.Context)
+}
+
+// rtp telephone events, until media is closed
+func (call *Call) listen() {
+	for event := range call.media.Events() {
+		if event.Digit != 0 {
+			call.press(string(event.Digit))
+		}
+	}
+}
+
+// connect call media from sdp answer
+func (call *Call) connect(body []byte) error {
+	answer, err := sdp.Parse(body)
+	if err != nil {
+		return err
+	}
+
+	audio := answer.Audio()
+	codec, err := sdp.Negotiate(audio, sdp.G711)
+	if err != nil {
+		return err
+	}
+	call.media.SetPayload(codec.Payload)
+	return call.media.Connect(answer.Address(audio), audio.Port)
+}
+
+func (call *Call) speak(ctx osip.Agent) {
+	config := current()
+	item := call.item
+	for {
+		text, options, volume := voice(item)
+		player := &callPlayer{call: call, volume: volume}
+		fileName, err := config.engine.Synthesize(text, options)
+		if err == nil {
+			setSpeaking(ctx, true)
+			err = player.Play(fileName)
+			setSpeaking(ctx, false)
+		}
+		if err != errInterrupted {
+			if err != nil {
+				service.Debug(2, "call speech ended; ", err)
+			}
+			break
+		}
+
+		if call.pressed == config.Repeat {
+			continue
+		}
+		next := getLatest()
+		if call.pressed != config.Skip || next.Text == item.Text {
+			break
+		}
+		item = next
+	}
+
+	if call.inbound && call.pressed != config.Stop && len(config.Operator) > 0 {
+		err := ctx.Transfer(call.did, config.Operator)
+		if err == nil {
+			service.Debug(2, "transfer call to ", config.Operator)
+			return
+		}
+		service.Error(err)
+	}
+	ctx.Hangup(call.cid, call.did)
+}
+
+// release call when closed or failed
+func endCall(event *osip.Event) {
+	callLock.Lock()
+	defer callLock.Unlock()
+	call, ok := calls[event.Call]
+	if !ok {
+		return
+	}
+	delete(calls, event.Call)
+	call.media.Close()
+	call.end()
+	service.Debug(2, "call ended; status=", event.Status)
+}
+
+// release all calls on shutdown
+func endCalls() {
+	callLock.Lock()
+	defer callLock.Unlock()
+	for cid, call := range calls {
+		delete(calls, cid)
+		call.media.Close()
+		call.end()
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	osip "babylon/internal/exosip2"
+	"babylon/internal/rtp"
+	"babylon/internal/tts"
+)
+
+func TestCallSpeak(t *testing.T) {
+	engine, err := tts.New(tts.Config{Engine: "tone", Folder: t.TempDir(), Language: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = &Config{Language: "en", Speed: 1, Volume: 100, engine: engine}
+
+	receiver, err := rtp.New(rtp.Config{Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	media, err := rtp.New(rtp.Config{Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer media.Close()
+	if err := media.Connect("127.0.0.1", receiver.Port); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := osip.NewMock(osip.Config{})
+	defer mock.Close()
+	call := &Call{cid: 1, did: 2, item: announcement{Text: "hello"}, media: media, digits: make(chan string, 1)}
+	call.speak(mock)
+
+	// half a second of tone is 25 g.711 frames
+	if stats := media.Stats(); stats.Sent < 25 {
+		t.Fatalf("sent %d frames", stats.Sent)
+	}
+	deadline := time.Now().Add(time.Second)
+	for receiver.Stats().Received < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if receiver.Stats().Received < 1 {
+		t.Fatal("no speech received")
+	}
+
+	hungup := false
+	for _, reply := range mock.Replies() {
+		if reply.Method == "BYE" && reply.Call == 1 {
+			hungup = true
+		}
+	}
+	if !hungup {
+		t.Fatal("call not hung up after speaking")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"babylon/internal/service"
+
+	osip "babylon/internal/exosip2"
+)
+
+// route sip events to netmouth handlers
+func routes(queue *speechQueue) *osip.Router {
+	router := osip.NewRouter(config.Workers)
+	router.Use(osip.Logging(func(args ...interface{}) {
+		service.Debug(3, args...)
+	}))
+
+	router.Handle(osip.EVT_SHUTDOWN, func(event *osip.Event) {
+		endCalls()
+	})
+	router.Handle(osip.EVT_STARTUP, func(event *osip.Event) {
+		service.Live("service started ", event.Context.GetAddress())
+		register(event.Context)
+	})
+	router.Handle(osip.EVT_REGISTER, registered)
+	router.Handle(osip.EVT_RETRY, func(event *osip.Event) {
+		service.Info("registration retry; id=", event.Identity, ", attempt=", event.Attempt)
+	})
+	router.Handle(osip.EVT_PEER_UP, func(event *osip.Event) {
+		service.Info("server reachable; latency=", event.Latency)
+		if event.Context.IsOnline() {
+			service.Status("online")
+		}
+	})
+	router.Handle(osip.EVT_PEER_DOWN, func(event *osip.Event) {
+		service.Status("unreachable")
+		service.Error("server unreachable; status=", event.Status)
+	})
+	router.Handle(osip.EVT_INVALID, func(event *osip.Event) {
+		service.Warn("denied request from ", event.Source, "; uri=", event.From)
+	})
+	router.Handle(osip.EVT_SENT, func(event *osip.Event) {
+		if event.Status != osip.SIP_OK && event.Status != osip.SIP_ACCEPTED {
+			service.Warn("reply failed; status=", event.Status)
+		}
+	})
+
+	router.HandleMatch(osip.EVT_MESSAGE, osip.Match{Content: "message/imdn+xml"}, func(event *osip.Event) {
+		event.Reply(osip.SIP_OK)
+	})
+	router.HandleMatch(osip.EVT_MESSAGE, osip.Match{Content: "text/plain"}, func(event *osip.Event) {
+		message(event, queue)
+	})
+	router.Handle(osip.EVT_SUBSCRIBE, subscribe)
+
+	router.Handle(osip.EVT_CALL_INVITE, func(event *osip.Event) {
+		if !current().Answer {
+			event.Reply(osip.SIP_METHOD_NOT_ALLOWED)
+			return
+		}
+		answerCall(event)
+	})
+	router.Handle(osip.EVT_CALL_REINVITE, func(event *osip.Event) {
+		event.Reply(osip.SIP_NOT_ACCEPTABLE_HERE)
+	})
+	router.Handle(osip.EVT_CALL_ACK, startCall)
+	router.Handle(osip.EVT_CALL_ANSWERED, startCall)
+	router.Handle(osip.EVT_DTMF, func(event *osip.Event) {
+		service.Debug(2, "digit ", event.Digit, " from ", event.From)
+		pressCall(event.Call, event.Digit)
+	})
+	router.Handle(osip.EVT_REFER, func(event *osip.Event) {
+		event.Reply(osip.SIP_DECLINE)
+	})
+	router.Handle(osip.EVT_TRANSFER, transferCall)
+	router.Handle(osip.EVT_CALL_REDIRECTED, redirectCall)
+	for _, kind := range []osip.EVT_TYPE{osip.EVT_CALL_FAILED, osip.EVT_CALL_CANCELLED, osip.EVT_CALL_CLOSED, osip.EVT_CALL_RELEASED} {
+		router.Handle(kind, endCall)
+	}
+	return router
+}
+
+func registered(event *osip.Event) {
+	if event.Status != osip.SIP_OK {
+		if !event.Context.IsOnline() {
+			service.Status("offline")
+		}
+		service.Error("registration failure; id=", event.Identity, ", status=", event.Status, ", retry=", event.Retry)
+	} else if event.Expires == 0 {
+		service.Info("unregistered; id=", event.Identity)
+	} else {
+		service.Status("online")
+		service.Info("service online; id=", event.Identity)
+	}
+}
+
+// queue text messages to speak, busy if the speech queue is full
+func message(event *osip.Event, queue *speechQueue) {
+	config := current()
+	if event.Status != osip.SIP_OK {
+		return
+	}
+
+	part := event.Part("text/plain")
+	if part == nil {
+		event.Reply(osip.SIP_NOT_ACCEPTABLE_HERE)
+		return
+	}
+
+	text, priority := parsePriority(string(part.Body), event.Priority())
+	if len(text) < 1 {
+		event.Reply(osip.SIP_OK)
+		return
+	}
+
+	service.Debug(2, "message from ", event.From, "; user=", event.User, ", priority=", priority, ", text=", text)
+	item := announcement{Text: text, From: event.From, Priority: priority}
+	queued, err := queue.push(item)
+	if err != nil {
+		service.Warn(err, "; from=", event.From)
+		event.Reply(osip.SIP_SERVICE_UNAVAILABLE)
+		return
+	}
+	event.Reply(osip.SIP_OK)
+	if !queued {
+		service.Debug(2, "duplicate message from ", event.From)
+		return
+	}
+	setLatest(item)
+	if len(config.Reply) > 0 {
+		_, err := event.Context.SendMessage(event.From, event.To, "text/plain", []byte(config.Reply))
+		if err != nil {
+			service.Error(err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	osip "babylon/internal/exosip2"
+)
+
+// mock agent and netmouth routes, events dispatched as the test reads them
+type harness struct {
+	mock   *osip.Mock
+	out    chan osip.Event
+	router *osip.Router
+	queue  *speechQueue
+}
+
+func newHarness(t *testing.T, settings Config) *harness {
+	settings.Workers = 1
+	config = &settings
+	h := &harness{mock: osip.NewMock(osip.Config{Server: "sip:localhost"}), out: make(chan osip.Event, 16), queue: newQueue(1, 0, time.Minute, "")}
+	h.router = routes(h.queue)
+	go h.mock.ListenAndServe("127.0.0.1:5060", h.out)
+	if event := <-h.out; event.Type != osip.EVT_STARTUP {
+		t.Fatalf("expected startup, got %v", event.Type)
+	}
+	t.Cleanup(h.mock.Close)
+	return h
+}
+
+// inject and dispatch an event, returning the reply status if any
+func (h *harness) send(t *testing.T, event osip.Event) osip.SIP_STATUS {
+	tid := h.mock.Inject(event)
+	select {
+	case event := <-h.out:
+		h.router.Dispatch(&event)
+	case <-time.After(time.Second):
+		t.Fatal("event not delivered")
+	}
+	reply, ok := h.mock.Find(tid)
+	if !ok {
+		return 0
+	}
+	return reply.Status
+}
+
+func TestMessageRoutes(t *testing.T) {
+	h := newHarness(t, Config{})
+	tests := []struct {
+		name    string
+		content string
+		text    string
+		want    osip.SIP_STATUS
+		queued  int
+	}{
+		{"spoken", "text/plain", "hello", osip.SIP_OK, 1},
+		{"duplicate", "text/plain", "Hello ", osip.SIP_OK, 1},
+		{"empty", "text/plain", "", osip.SIP_OK, 1},
+		{"lower priority when full", "text/plain", "!non-urgent later", osip.SIP_SERVICE_UNAVAILABLE, 1},
+		{"delivery report", "message/imdn+xml", "<imdn/>", osip.SIP_OK, 1},
+		{"unsupported content", "application/json", "{}", osip.SIP_NOT_ACCEPTABLE_HERE, 1},
+	}
+	for _, test := range tests {
+		status := h.send(t, osip.Event{Type: osip.EVT_MESSAGE, Status: osip.SIP_OK, Method: "MESSAGE", From: "sip:alice@example.com", To: "sip:88@localhost", Content: test.content, Body: []byte(test.text), Parts: []osip.Part{{Content: test.content, Body: []byte(test.text)}}, Call: -1, Dialog: -1})
+		if status != test.want {
+			t.Errorf("%s: got status %d, want %d", test.name, status, test.want)
+		}
+		if queued := len(h.queue.items); queued != test.queued {
+			t.Errorf("%s: %d queued, want %d", test.name, queued, test.queued)
+		}
+	}
+	status := h.send(t, osip.Event{Type: osip.EVT_MESSAGE, Status: osip.SIP_OK, Method: "MESSAGE", From: "sip:alice@example.com", To: "sip:88@localhost", Content: "text/plain", Call: -1, Dialog: -1})
+	if status != osip.SIP_NOT_ACCEPTABLE_HERE {
+		t.Errorf("message without parts: got status %d", status)
+	}
+	if latest := getLatest(); latest.Text != "hello" {
+		t.Errorf("latest announcement %q", latest.Text)
+	}
+}
+
+func TestRequestRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer bool
+		event  osip.Event
+		want   osip.SIP_STATUS
+		notify bool
+	}{
+		{"invite not answered", false, osip.Event{Type: osip.EVT_CALL_INVITE, Method: "INVITE", Call: 1, Dialog: 1}, osip.SIP_METHOD_NOT_ALLOWED, false},
+		{"invite without sdp", true, osip.Event{Type: osip.EVT_CALL_INVITE, Method: "INVITE", Call: 1, Dialog: 1, Content: "text/plain"}, osip.SIP_NOT_ACCEPTABLE_HERE, false},
+		{"invite bad sdp", true, osip.Event{Type: osip.EVT_CALL_INVITE, Method: "INVITE", Call: 1, Dialog: 1, Content: "application/sdp", Body: []byte("v=0\r\n")}, osip.SIP_NOT_ACCEPTABLE_HERE, false},
+		{"reinvite", true, osip.Event{Type: osip.EVT_CALL_REINVITE, Method: "INVITE", Call: 1, Dialog: 1}, osip.SIP_NOT_ACCEPTABLE_HERE, false},
+		{"refer", true, osip.Event{Type: osip.EVT_REFER, Method: "REFER", Call: -1, Dialog: 2}, osip.SIP_DECLINE, false},
+		{"presence", false, osip.Event{Type: osip.EVT_SUBSCRIBE, Method: "SUBSCRIBE", Package: "presence", Call: -1, Dialog: 3}, osip.SIP_OK, true},
+		{"dialog", false, osip.Event{Type: osip.EVT_SUBSCRIBE, Method: "SUBSCRIBE", Package: "dialog", Call: -1, Dialog: 4}, osip.SIP_OK, true},
+		{"unknown package", false, osip.Event{Type: osip.EVT_SUBSCRIBE, Method: "SUBSCRIBE", Package: "message-summary", Call: -1, Dialog: 5}, osip.SIP_BAD_EVENT, false},
+	}
+	for _, test := range tests {
+		h := newHarness(t, Config{Answer: test.answer})
+		test.event.From = "sip:alice@example.com"
+		test.event.To = "sip:88@localhost"
+		if status := h.send(t, test.event); status != test.want {
+			t.Errorf("%s: got status %d, want %d", test.name, status, test.want)
+		}
+		notified := false
+		for _, reply := range h.mock.Replies() {
+			if reply.Method == "NOTIFY" && reply.Dialog == test.event.Dialog {
+				notified = true
+			}
+		}
+		if notified != test.notify {
+			t.Errorf("%s: notified %v, want %v", test.name, notified, test.notify)
+		}
+	}
+}
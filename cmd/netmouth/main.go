@@ -16,22 +16,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"babylon/internal/service"
+	"babylon/internal/tts"
 
 	"github.com/alexflint/go-arg"
 	"github.com/percivalalb/sipuri"
 	"gopkg.in/ini.v1"
 
 	osip "babylon/internal/exosip2"
-	htgotts "github.com/hegedustibor/htgo-tts"
-	handlers "github.com/hegedustibor/htgo-tts/handlers"
 	//voices "github.com/hegedustibor/htgo-tts/voices"
 )
 
@@ -43,33 +45,87 @@ type Args struct {
 	Prefix  string `arg:"--prefix" help:"server prefix path"`
 	Ipv6    bool   `arg:"-6" help:"enable ipv6 support"`
 	Tcp     bool   `arg:"-t" help:"enable tcp sip support"`
+	Tls     bool   `arg:"-s" help:"enable tls sip support"`
 	Verbose int    `arg:"-v,--verbose" help:"debugging log level"`
 }
 
 // SIP registiry and local config
 type Config struct {
-	Host     string `ini:"host"`
-	Port     uint16 `ini:"port"`
-	Ipv6     bool   `ini:"ipv6"`
-	Tcp      bool   `ini:"tcp"`
-	Refresh  int    `ini:"refresh"`
-	Buffer   int    `ini:"events"`
-	Timeout  int    `ini:"timeout"`
-	Server   string `ini:"server"`
-	Identity string `ini:"identity"`
-	Secret   string `ini:"secret"`
-	User     string `ini:"user"`
+	Host      string  `ini:"host"`
+	Port      uint16  `ini:"port"`
+	Ipv6      bool    `ini:"ipv6"`
+	Tcp       bool    `ini:"tcp"`
+	Tls       bool    `ini:"tls"`
+	Cert      string  `ini:"certificate"`
+	Key       string  `ini:"key"`
+	Ca        string  `ini:"ca"`
+	Verify    bool    `ini:"verify"`
+	Refresh   int     `ini:"refresh"`
+	Buffer    int     `ini:"events"`
+	Workers   int     `ini:"workers"`
+	Timeout   int     `ini:"timeout"`
+	Ping      int     `ini:"keepalive"`
+	Backoff   int     `ini:"backoff"`
+	Drain     int     `ini:"drain"`
+	Public    string  `ini:"public"`
+	Stun      string  `ini:"stun"`
+	Rport     bool    `ini:"rport"`
+	NatPing   int     `ini:"nat_keepalive"`
+	Allow     string  `ini:"allow"`
+	Deny      string  `ini:"deny"`
+	Rate      float64 `ini:"rate"`
+	Burst     int     `ini:"burst"`
+	PerRate   float64 `ini:"source_rate"`
+	PerBurst  int     `ini:"source_burst"`
+	Overflow  string  `ini:"overflow"`
+	Server    string  `ini:"server"`
+	Identity  string  `ini:"identity"`
+	Secret    string  `ini:"secret"`
+	User      string  `ini:"user"`
+	Reply     string  `ini:"reply"`
+	Answer    bool    `ini:"answer"`
+	Dial      string  `ini:"dial"`
+	Operator  string  `ini:"operator"`
+	Greeting  string  `ini:"greeting"`
+	Repeat    string  `ini:"repeat"`
+	Skip      string  `ini:"skip"`
+	Stop      string  `ini:"stop"`
+	QueueSize int     `ini:"queue_size"`
+	QueueAge  int     `ini:"queue_age"`
+	Dedup     int     `ini:"dedup"`
+	Persist   bool    `ini:"persist"`
+	Realm     string  `ini:"realm"`
+	Users     string  `ini:"users"`
 
 	// tts values
-	Proxy    string `ini:"proxy"`
-	Native   bool   `ini:"native"`
-	Language string `ini:"language"`
+	Engine   string  `ini:"engine"`
+	Proxy    string  `ini:"proxy"`
+	Native   bool    `ini:"native"`
+	Language string  `ini:"language"`
+	Voice    string  `ini:"voice"`
+	Speed    float64 `ini:"speed"`
+	Volume   int     `ini:"volume"`
+	Model    string  `ini:"model"`
+	Command  string  `ini:"command"`
 
 	// more internal...
+	accounts []account
+	callers  map[string]string // digest users allowed to send
+	acl      *osip.ACL
+	overflow osip.OVERFLOW
+	engine   tts.Engine
+	profiles []profile
 	register string
 	route    string
 }
 
+// registration account for an identity
+type account struct {
+	identity string
+	user     string
+	secret   string
+}
+
 var (
 	// bind Makefile config
 	prefixPath = "/var/lib/babylon"
@@ -91,8 +147,9 @@ func (Args) Description() string {
 	return "netmouth - TTS speaks sip chat messages"
 }
 
-// initialize server and parse arguments
-func init() {
+// initialize server and parse arguments, from main so tests can set
+// config without them
+func setup() {
 	// parse arguments
 	for pos, arg := range os.Args {
 		switch arg {
@@ -115,25 +172,39 @@ func init() {
 	// setup service
 	logPath := logPrefix + "/notmouth.log"
 	service.Logger(args.Verbose, logPath)
-	load()
+	if err := load(); err != nil {
+		service.Fail(99, err)
+	}
 	err := os.Chdir(args.Prefix)
 	if err != nil {
 		service.Fail(1, err)
 	}
 }
 
-// load server config file
-func load() {
+// load server config file, keeping the current config on error
+func load() error {
 	// default config
 	new_config := Config{
-		Host:     args.Host,
-		Port:     args.Port,
-		Server:   "sip:localhost",
-		Identity: "sip:88@localhost",
-		Refresh:  300,
-		Timeout:  500,
-		Language: "en",
-		Native:   true,
+		Host:      args.Host,
+		Port:      args.Port,
+		Server:    "sip:localhost",
+		Identity:  "sip:88@localhost",
+		Refresh:   300,
+		Timeout:   500,
+		Rport:     true,
+		Workers:   4,
+		Buffer:    64,
+		Language:  "en",
+		Speed:     1,
+		Volume:    100,
+		Native:    true,
+		Greeting:  "no announcements",
+		Repeat:    "1",
+		Skip:      "#",
+		Stop:      "*",
+		QueueSize: 32,
+		QueueAge:  600,
+		Dedup:     30,
 	}
 
 	configs, err := ini.LoadSources(ini.LoadOptions{Loose: true, Insensitive: true}, args.Config, args.Prefix+"/custom.conf")
@@ -142,6 +213,10 @@ func load() {
 		configs.Section("sip").MapTo(&new_config)
 		configs.Section("tts").MapTo(&new_config)
 		configs.Section("netmouth").MapTo(&new_config)
+		new_config.profiles, err = loadProfiles(configs, &new_config)
+		if err != nil {
+			return err
+		}
 		if args.Port != 0 {
 			new_config.Port = args.Port
 		}
@@ -157,31 +232,110 @@ func load() {
 		if args.Tcp {
 			new_config.Tcp = true
 		}
+
+		if args.Tls {
+			new_config.Tls = true
+		}
 	} else {
 		service.Error(err)
 	}
 
-	identity, err := sipuri.Parse(new_config.Identity)
-	if err == nil && len(identity.User()) < 1 && len(new_config.User) < 1 {
-		err = fmt.Errorf("no user for registration identity")
+	// identity may list several registrations, the first is primary
+	for pos, uri := range strings.Split(new_config.Identity, ",") {
+		uri = strings.TrimSpace(uri)
+		if len(uri) < 1 {
+			continue
+		}
+		identity, err := sipuri.Parse(uri)
+		if err == nil && len(identity.User()) < 1 && (pos > 0 || len(new_config.User) < 1) {
+			err = fmt.Errorf("no user for registration identity")
+		}
+		if err != nil {
+			return fmt.Errorf("%v; identity=%s", err, uri)
+		}
+
+		register := sipuri.New(identity.User(), identity.Host())
+		if identity.Secure() {
+			register = sipuri.New(identity.User(), identity.Host(), sipuri.Secure())
+		}
+		user, secret := identity.User(), identity.Password()
+		if pos == 0 {
+			new_config.register = register.String()
+			if len(new_config.Secret) < 1 {
+				new_config.Secret = secret
+			}
+			if len(new_config.User) < 1 {
+				new_config.User = user
+			}
+			user, secret = new_config.User, new_config.Secret
+		} else if len(secret) < 1 {
+			secret = new_config.Secret
+		}
+		new_config.accounts = append(new_config.accounts, account{identity: register.String(), user: user, secret: secret})
+	}
+	if len(new_config.accounts) < 1 {
+		return fmt.Errorf("no registration identity")
 	}
+
+	acl, err := osip.NewACL(new_config.Allow, new_config.Deny)
 	if err != nil {
-		service.Fail(99, err, config.Identity)
+		return err
 	}
+	new_config.acl = acl
 
-	new_config.register = sipuri.New(identity.User(), identity.Host()).String()
-	if len(new_config.Secret) < 1 {
-		new_config.Secret = identity.Password()
+	overflow, err := osip.ParseOverflow(new_config.Overflow)
+	if err != nil {
+		return err
+	}
+	if overflow != osip.OVERFLOW_BLOCK && new_config.Buffer < 1 {
+		return fmt.Errorf("overflow %s requires an events buffer", new_config.Overflow)
+	}
+	new_config.overflow = overflow
+
+	// users allowed to send, as user:secret list
+	new_config.callers = make(map[string]string)
+	for _, entry := range strings.Split(new_config.Users, ",") {
+		user := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(user[0]) < 1 {
+			continue
+		}
+		if len(user) < 2 {
+			return fmt.Errorf("no secret for user %s", user[0])
+		}
+		new_config.callers[user[0]] = user[1]
 	}
-	if len(new_config.User) < 1 {
-		new_config.User = identity.User()
+	if len(new_config.Realm) < 1 {
+		new_config.Realm = "netmouth"
 	}
 
 	route, err := sipuri.Parse(new_config.Server)
 	if err != nil {
-		service.Fail(99, err, new_config.Server)
+		return fmt.Errorf("%v; server=%s", err, new_config.Server)
 	}
 	new_config.route = "sip:" + route.Host()
+	if route.Secure() {
+		new_config.route = "sips:" + route.Host()
+		new_config.Tls = true
+	}
+
+	if new_config.Tls && len(new_config.Cert) < 1 {
+		new_config.Cert = "server.crt"
+		new_config.Key = "server.key"
+	}
+
+	engine, err := tts.New(tts.Config{
+		Engine:   new_config.Engine,
+		Folder:   args.Prefix + "/tts",
+		Language: new_config.Language,
+		Voice:    new_config.Voice,
+		Model:    new_config.Model,
+		Command:  new_config.Command,
+		Proxy:    new_config.Proxy,
+	})
+	if err != nil {
+		return err
+	}
+	new_config.engine = engine
 
 	// constraints and flags
 	if new_config.Host == "*" {
@@ -190,37 +344,112 @@ func load() {
 	lock.Lock()
 	defer lock.Unlock()
 	config = &new_config
+	return nil
+}
+
+// current config, which reload replaces rather than changes
+func current() *Config {
+	lock.RLock()
+	defer lock.RUnlock()
+	return config
+}
+
+// file to keep pending announcements in, if persistent
+func persistence() string {
+	if !config.Persist {
+		return ""
+	}
+	return args.Prefix + "/queue.json"
+}
+
+// register all configured identities, removing stale ones
+func register(ctx osip.Agent) {
+	config := current()
+	active := make(map[string]bool)
+	for _, account := range config.accounts {
+		active[account.identity] = true
+		err := ctx.Register(account.identity, account.user, account.secret)
+		if err != nil {
+			service.Error(err)
+		}
+	}
+	for _, identity := range ctx.GetIdentities() {
+		if !active[identity] {
+			ctx.UnregisterIdentity(identity)
+		}
+	}
+}
+
+// apply access rules, and require digest authentication of senders if
+// users are configured
+func authenticate(ctx osip.Agent) {
+	lock.RLock()
+	defer lock.RUnlock()
+	ctx.SetACL(config.acl)
+	if len(config.callers) < 1 {
+		ctx.SetAuthenticator("", nil)
+		return
+	}
+	ctx.SetAuthenticator(config.Realm, func(user string) (string, bool) {
+		lock.RLock()
+		defer lock.RUnlock()
+		secret, ok := config.callers[user]
+		return secret, ok
+	})
 }
 
 func main() {
+	setup()
 	cache := args.Prefix + "/tts"
 	address := fmt.Sprintf("%s:%v", config.Host, config.Port)
-	route, err := sipuri.Parse(config.Server)
-	if err != nil {
-		service.Fail(99, err, config.Server)
-	}
 
 	service.Debug(3, "prefix=", args.Prefix, ", bind=", address)
-	service.Debug(3, "server=", "sip:"+route.Host(), ", identity=", config.register)
+	service.Debug(3, "server=", config.route, ", identity=", config.register)
 	os.RemoveAll(cache)
 	os.Mkdir(cache, 0770)
 	defer os.RemoveAll(cache)
 
+	allows := "OPTIONS,MESSAGE,SUBSCRIBE,NOTIFY"
+	if config.Answer || len(config.Dial) > 0 {
+		allows = "INVITE,ACK,BYE,CANCEL,OPTIONS,MESSAGE,SUBSCRIBE,NOTIFY"
+	}
+
 	sip := osip.New(osip.Config{
-		Agent:   "netmouth/" + version,
-		Ipv6:    config.Ipv6,
-		Server:  config.route,
-		Refresh: config.Refresh,
-		Allows:  "OPTIONS,MESSAGE",
+		Agent:        "netmouth/" + version,
+		Ipv6:         config.Ipv6,
+		Tcp:          config.Tcp,
+		Server:       config.route,
+		Refresh:      config.Refresh,
+		Keepalive:    config.Ping,
+		Backoff:      config.Backoff,
+		Drain:        config.Drain,
+		Public:       config.Public,
+		Stun:         config.Stun,
+		Rport:        config.Rport,
+		NatKeepalive: config.NatPing,
+		Rate:         config.Rate,
+		Burst:        config.Burst,
+		SourceRate:   config.PerRate,
+		SourceBurst:  config.PerBurst,
+		Overflow:     config.overflow,
+		Allows:       allows,
+		Certificate:  config.Cert,
+		PrivateKey:   config.Key,
+		Authority:    config.Ca,
+		Verify:       config.Verify,
 	})
 
+	authenticate(sip)
+
 	// signal handler...
 	signals := make(chan os.Signal, 1)
-	texts := make(chan string, 32)
+	reload := make(chan struct{}, 1)
+	queue := newQueue(config.QueueSize, time.Duration(config.QueueAge)*time.Second, time.Duration(config.Dedup)*time.Second, persistence())
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	shutdown, stop := context.WithCancel(context.Background())
 
 	go func() {
-		defer sip.Close()
+		defer stop()
 		for {
 			switch <-signals {
 			case os.Interrupt: // sigint/ctrl-c
@@ -232,85 +461,79 @@ func main() {
 				service.Reload("reload service")
 				service.LoggerRestart()
 				runtime.GC()
-				load()
-				if sip.SetRoute(config.route) {
-					service.Info("changed route to ", config.route)
+				if err := load(); err != nil {
+					service.Error("reload failed; ", err)
+					service.Live()
+					continue
+				}
+				if route := current().route; sip.SetRoute(route) {
+					service.Info("changed route to ", route)
+				}
+				register(sip)
+				authenticate(sip)
+				state := sip.Snapshot()
+				for _, reg := range state.Registrations {
+					service.Debug(2, "registration ", reg.Identity, "; online=", reg.Online, ", failures=", reg.Failures)
+				}
+				select {
+				case reload <- struct{}{}:
+				default:
 				}
-				sip.Register(config.Identity, config.User, config.Secret)
-				texts <- "-reload-"
 				service.Live()
 			}
 		}
 	}()
 
-	go func(say <-chan string) {
-		var handler handlers.PlayerInterface
-		handler = &handlers.Native{}
-		if !config.Native {
-			handler = &handlers.MPlayer{}
-		}
-
-		speach := htgotts.Speech{Folder: args.Prefix + "/tts", Language: config.Language, Handler: handler, Proxy: config.Proxy}
+	go func() {
 		for {
-			text := <-say
-			switch text {
-			case "-reload-":
+			select {
+			case <-reload:
 				os.RemoveAll(cache)
-			case "":
 				continue
-			default:
-				err := speach.Speak(text)
-				if err != nil {
-					service.Error(err)
-				}
+			case <-queue.ready:
 			}
-		}
-	}(texts)
 
-	events := make(chan osip.Event, config.Buffer)
-	go func(ch <-chan osip.Event, say chan<- string) {
-		defer service.Stop("stop service")
-		for {
-			event := <-ch
-			ctx := event.Context
-			service.Debug(3, "event type: ", event.Type)
-			switch event.Type {
-			case osip.EVT_SHUTDOWN:
-				return
-			case osip.EVT_STARTUP:
-				service.Live("service started ", ctx.Host, ":", ctx.Port)
-				ctx.Register(config.Identity, config.User, config.Secret)
-			case osip.EVT_REGISTER:
-				if event.Status != osip.SIP_OK {
-					service.Status("offline")
-					service.Error("registration failure; status=", event.Status)
-				} else {
-					service.Status("online")
-					service.Info("service online; id=", ctx.GetIdentity())
-				}
-			case osip.EVT_MESSAGE:
-				if event.Status != osip.SIP_OK {
+			for {
+				item, ok := queue.pop()
+				if !ok {
 					break
 				}
-				if event.Content == "message/imdn+xml" {
-					event.Reply(osip.SIP_OK)
-					break
+				var err error
+				if dial := current().Dial; len(dial) > 0 {
+					// one announcement call at a time
+					done := make(chan struct{})
+					err = dialCall(sip, dial, item, 0, done)
+					if err == nil {
+						select {
+						case <-done:
+						case <-shutdown.Done():
+							return
+						}
+					}
+				} else {
+					err = speak(sip, item)
 				}
-				if event.Content != "text/plain" {
-					service.Debug(2, "ignored message input ", event.Content)
-					event.Reply(osip.SIP_NOT_ACCEPTABLE_HERE)
-					break
+				queue.done()
+				if err != nil {
+					service.Error(err)
 				}
-				text := string(event.Body)
-				service.Debug(2, "message from ", event.From, "; text=", text)
-				event.Reply(osip.SIP_OK)
-				say <- text
 			}
 		}
-	}(events, texts)
+	}()
 
-	err = sip.ListenAndServe(address, events)
-	if err != nil {
+	events := make(chan osip.Event, config.Buffer)
+	router := routes(queue)
+	go func() {
+		defer service.Stop("stop service")
+		router.Serve(events)
+	}()
+
+	err := sip.ListenAndServeContext(shutdown, address, events)
+	sip.Close()
+	if err != nil && shutdown.Err() != nil {
+		// incomplete drain on a requested stop is not a failure
+		service.Warn(err)
+	} else if err != nil {
 		service.Fail(1, err)
 	}
 }
@@ -0,0 +1,57 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadKeepsConfig(t *testing.T) {
+	prefix := t.TempDir()
+	args = &Args{Prefix: prefix, Config: filepath.Join(prefix, "babylon.conf")}
+	write := func(text string) {
+		if err := os.WriteFile(args.Config, []byte(text), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("[sip]\nidentity = sip:88@pbx.local\n[tts]\nengine = tone\n[profile.lobby]\nfrom = sip:100@*\nvoice = fr\n")
+	if err := load(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := current()
+	if loaded.register != "sip:88@pbx.local" || profileFor("sip:100@pbx.local").Voice != "fr" {
+		t.Fatalf("config not loaded: %s", loaded.register)
+	}
+
+	bad := []string{
+		"[tts]\nengine = bogus\n",
+		"[sip]\nidentity = sip:pbx.local\n",
+		"[netmouth]\nusers = alice\n",
+		"[profile.lobby]\nfrom = 10.0.0.0/8\n",
+	}
+	for _, text := range bad {
+		write(text)
+		if err := load(); err == nil {
+			t.Errorf("%q: loaded", text)
+		}
+		if current() != loaded {
+			t.Fatalf("%q: config replaced", text)
+		}
+	}
+}
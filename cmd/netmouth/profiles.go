@@ -0,0 +1,87 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"babylon/internal/service"
+	"babylon/internal/tts"
+
+	"gopkg.in/ini.v1"
+
+	osip "babylon/internal/exosip2"
+)
+
+// voice profile for senders matching from uri patterns or domains
+type profile struct {
+	name     string
+	match    *osip.ACL
+	From     string  `ini:"from"`
+	Language string  `ini:"language"`
+	Voice    string  `ini:"voice"`
+	Model    string  `ini:"model"`
+	Speed    float64 `ini:"speed"`
+	Volume   int     `ini:"volume"`
+	Preamble string  `ini:"preamble"`
+}
+
+// load [profile.name] sections in file order, defaults from tts
+func loadProfiles(configs *ini.File, defaults *Config) ([]profile, error) {
+	var profiles []profile
+	for _, section := range configs.Sections() {
+		if !strings.HasPrefix(section.Name(), "profile.") {
+			continue
+		}
+
+		entry := profile{name: strings.TrimPrefix(section.Name(), "profile."), Language: defaults.Language, Voice: defaults.Voice, Model: defaults.Model, Speed: defaults.Speed, Volume: defaults.Volume}
+		err := section.MapTo(&entry)
+		if err == nil && len(strings.TrimSpace(entry.From)) < 1 {
+			service.Warn("profile ", entry.name, " has no senders")
+			continue
+		}
+		if err == nil {
+			entry.match, err = osip.NewACL(entry.From, "")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("profile %s; %v", entry.name, err)
+		}
+		profiles = append(profiles, entry)
+	}
+	return profiles, nil
+}
+
+// first profile matching a sender, or the tts defaults
+func profileFor(from string) profile {
+	config := current()
+	for _, entry := range config.profiles {
+		if len(from) > 0 && entry.match.Permit(from) {
+			return entry
+		}
+	}
+	return profile{Language: config.Language, Voice: config.Voice, Model: config.Model, Speed: config.Speed, Volume: config.Volume}
+}
+
+// text, voice, and volume to speak an announcement with
+func voice(item announcement) (string, tts.Options, float64) {
+	entry := profileFor(item.From)
+	text := item.Text
+	if len(entry.Preamble) > 0 {
+		text = entry.Preamble + " " + text
+	}
+	return text, tts.Options{Language: entry.Language, Voice: entry.Voice, Model: entry.Model, Speed: entry.Speed}, float64(entry.Volume) / 100
+}
@@ -0,0 +1,228 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"babylon/internal/service"
+)
+
+// announcement priority, from the sip priority header or a text prefix
+const (
+	priorityNonUrgent = iota
+	priorityNormal
+	priorityUrgent
+	priorityEmergency
+)
+
+var priorities = map[string]int{
+	"non-urgent": priorityNonUrgent,
+	"normal":     priorityNormal,
+	"urgent":     priorityUrgent,
+	"emergency":  priorityEmergency,
+}
+
+var errQueueFull = errors.New("speech queue full")
+
+// queued announcement
+type announcement struct {
+	Text     string    `json:"text"`
+	From     string    `json:"from"`
+	Priority int       `json:"priority"`
+	Queued   time.Time `json:"queued"`
+}
+
+// bounded speech queue ordered by priority, then arrival
+type speechQueue struct {
+	lock   sync.Mutex
+	items  []announcement
+	active *announcement // popped but still persisted until done
+	recent map[string]time.Time
+	ready  chan struct{}
+	limit  int
+	age    time.Duration
+	window time.Duration
+	path   string
+}
+
+// create queue, restoring pending announcements if persistent
+func newQueue(limit int, age, window time.Duration, path string) *speechQueue {
+	if limit < 1 {
+		limit = 1
+	}
+	queue := &speechQueue{recent: make(map[string]time.Time), ready: make(chan struct{}, 1), limit: limit, age: age, window: window, path: path}
+	if len(path) < 1 {
+		return queue
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &queue.items)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		service.Error("speech queue restore failed; ", err)
+	}
+	queue.expire(time.Now())
+	if len(queue.items) > limit {
+		service.Warn("dropped ", len(queue.items)-limit, " restored announcements over queue size")
+		queue.items = queue.items[:limit]
+		queue.save()
+	}
+	if len(queue.items) > 0 {
+		service.Info("restored ", len(queue.items), " announcements")
+		queue.notify()
+	}
+	return queue
+}
+
+// split a !priority prefix from message text
+func parsePriority(text, header string) (string, int) {
+	level, ok := priorities[strings.ToLower(strings.TrimSpace(header))]
+	if !ok {
+		level = priorityNormal
+	}
+	if strings.HasPrefix(text, "!") {
+		fields := strings.SplitN(text[1:], " ", 2)
+		if prefix, ok := priorities[strings.ToLower(fields[0])]; ok {
+			level, text = prefix, ""
+			if len(fields) > 1 {
+				text = strings.TrimSpace(fields[1])
+			}
+		}
+	}
+	return text, level
+}
+
+// push an announcement, false if it repeats one in the dedup window
+func (queue *speechQueue) push(item announcement) (bool, error) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	now := time.Now()
+	queue.expire(now)
+	key := strings.ToLower(strings.Join(strings.Fields(item.Text), " "))
+	if last, ok := queue.recent[key]; ok && now.Sub(last) < queue.window {
+		return false, nil
+	}
+
+	// evict the oldest lowest priority announcement to make room, so an
+	// equal priority announcement replaces the oldest
+	if len(queue.items) >= queue.limit {
+		last := len(queue.items) - 1
+		lowest := last
+		for pos := last; pos >= 0 && queue.items[pos].Priority == queue.items[last].Priority; pos-- {
+			lowest = pos
+		}
+		if queue.items[lowest].Priority > item.Priority {
+			return false, errQueueFull
+		}
+		service.Warn("evicted announcement from ", queue.items[lowest].From)
+		queue.items = append(queue.items[:lowest], queue.items[lowest+1:]...)
+	}
+
+	item.Queued = now
+	pos := len(queue.items)
+	for pos > 0 && queue.items[pos-1].Priority < item.Priority {
+		pos--
+	}
+	queue.items = append(queue.items, announcement{})
+	copy(queue.items[pos+1:], queue.items[pos:])
+	queue.items[pos] = item
+	if queue.window > 0 {
+		queue.recent[key] = now
+	}
+	queue.save()
+	queue.notify()
+	return true, nil
+}
+
+// pop the next announcement, if any, which stays persisted until done
+// so it is spoken again if interrupted by a restart
+func (queue *speechQueue) pop() (announcement, bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.expire(time.Now())
+	if len(queue.items) < 1 {
+		return announcement{}, false
+	}
+	item := queue.items[0]
+	queue.items = queue.items[1:]
+	queue.active = &item
+	return item, true
+}
+
+// done playing the popped announcement
+func (queue *speechQueue) done() {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	if queue.active != nil {
+		queue.active = nil
+		queue.save()
+	}
+}
+
+// drop announcements past max age and forget old duplicates
+func (queue *speechQueue) expire(now time.Time) {
+	if queue.age > 0 {
+		items := queue.items[:0]
+		for _, item := range queue.items {
+			if now.Sub(item.Queued) < queue.age {
+				items = append(items, item)
+			} else {
+				service.Debug(2, "expired announcement from ", item.From)
+			}
+		}
+		queue.items = items
+	}
+	for key, last := range queue.recent {
+		if now.Sub(last) >= queue.window {
+			delete(queue.recent, key)
+		}
+	}
+}
+
+func (queue *speechQueue) notify() {
+	select {
+	case queue.ready <- struct{}{}:
+	default:
+	}
+}
+
+// write pending announcements, with queue locked
+func (queue *speechQueue) save() {
+	if len(queue.path) < 1 {
+		return
+	}
+	items := queue.items
+	if queue.active != nil {
+		items = append([]announcement{*queue.active}, items...)
+	}
+	data, err := json.Marshal(items)
+	if err == nil {
+		err = os.WriteFile(queue.path+".tmp", data, 0660)
+	}
+	if err == nil {
+		err = os.Rename(queue.path+".tmp", queue.path)
+	}
+	if err != nil {
+		service.Error("speech queue save failed; ", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		text   string
+		header string
+		want   string
+		level  int
+	}{
+		{"hello", "", "hello", priorityNormal},
+		{"hello", "urgent", "hello", priorityUrgent},
+		{"hello", " Emergency ", "hello", priorityEmergency},
+		{"hello", "bogus", "hello", priorityNormal},
+		{"!emergency fire in lab", "", "fire in lab", priorityEmergency},
+		{"!non-urgent lunch", "urgent", "lunch", priorityNonUrgent},
+		{"!urgent", "", "", priorityUrgent},
+		{"!wow that", "", "!wow that", priorityNormal},
+	}
+	for _, test := range tests {
+		text, level := parsePriority(test.text, test.header)
+		if text != test.want || level != test.level {
+			t.Errorf("%q %q: got %q %d, want %q %d", test.text, test.header, text, level, test.want, test.level)
+		}
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	queue := newQueue(3, 0, 0, "")
+	tests := []struct {
+		item   announcement
+		queued bool
+		fails  bool
+	}{
+		{announcement{Text: "one", Priority: priorityNormal}, true, false},
+		{announcement{Text: "two", Priority: priorityNonUrgent}, true, false},
+		{announcement{Text: "three", Priority: priorityUrgent}, true, false},
+		{announcement{Text: "four", Priority: priorityNonUrgent}, true, false},
+		{announcement{Text: "five", Priority: priorityEmergency}, true, false},
+		{announcement{Text: "six", Priority: priorityNonUrgent}, false, true},
+	}
+	for _, test := range tests {
+		queued, err := queue.push(test.item)
+		if queued != test.queued || (err != nil) != test.fails {
+			t.Errorf("%s: got %v %v", test.item.Text, queued, err)
+		}
+	}
+
+	for _, want := range []string{"five", "three", "one"} {
+		item, ok := queue.pop()
+		if !ok || item.Text != want {
+			t.Errorf("got %q, want %q", item.Text, want)
+		}
+	}
+	if item, ok := queue.pop(); ok {
+		t.Errorf("unexpected %q", item.Text)
+	}
+}
+
+func TestQueueDedup(t *testing.T) {
+	queue := newQueue(8, 0, time.Minute, "")
+	tests := []struct {
+		text   string
+		queued bool
+	}{
+		{"Fire drill at noon", true},
+		{"fire  drill at NOON", false},
+		{"fire drill at one", true},
+	}
+	for _, test := range tests {
+		if queued, _ := queue.push(announcement{Text: test.text}); queued != test.queued {
+			t.Errorf("%q: got %v, want %v", test.text, queued, test.queued)
+		}
+	}
+}
+
+func TestQueueExpire(t *testing.T) {
+	queue := newQueue(8, time.Minute, 0, "")
+	queue.push(announcement{Text: "stale"})
+	queue.push(announcement{Text: "fresh"})
+	queue.items[0].Queued = time.Now().Add(-2 * time.Minute)
+	item, ok := queue.pop()
+	if !ok || item.Text != "fresh" {
+		t.Errorf("got %q, want fresh", item.Text)
+	}
+}
+
+func TestQueuePersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	queue := newQueue(8, 0, 0, path)
+	queue.push(announcement{Text: "first"})
+	queue.push(announcement{Text: "second"})
+	queue.pop()
+
+	// interrupted before done, so first is spoken again
+	restored := newQueue(8, 0, 0, path)
+	if item, ok := restored.pop(); !ok || item.Text != "first" {
+		t.Errorf("restored %q, want first", item.Text)
+	}
+	select {
+	case <-restored.ready:
+	default:
+		t.Error("restored queue not ready")
+	}
+
+	queue.push(announcement{Text: "third"})
+	queue.done()
+	restored = newQueue(8, 0, 0, path)
+	for _, want := range []string{"second", "third"} {
+		if item, ok := restored.pop(); !ok || item.Text != want {
+			t.Errorf("restored %q, want %s", item.Text, want)
+		}
+	}
+
+	// restored items beyond a smaller queue size are dropped
+	restored = newQueue(1, 0, 0, path)
+	if len(restored.items) != 1 || restored.items[0].Text != "second" {
+		t.Errorf("restored %v into queue of one", restored.items)
+	}
+}
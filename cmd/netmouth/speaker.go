@@ -0,0 +1,90 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"babylon/internal/tts"
+
+	"github.com/hajimehoshi/oto/v2"
+
+	osip "babylon/internal/exosip2"
+	handlers "github.com/hegedustibor/htgo-tts/handlers"
+)
+
+// rate of local audio output
+const speakerRate = 24000
+
+// plays wav or mp3 speech thru one shared oto context
+type nativePlayer struct {
+	volume float64
+}
+
+var (
+	speaker     *oto.Context
+	speakerErr  error
+	speakerOnce sync.Once
+)
+
+func (player *nativePlayer) Play(fileName string) error {
+	speech, err := tts.Decode(fileName)
+	if err != nil {
+		return err
+	}
+
+	speakerOnce.Do(func() {
+		var ready chan struct{}
+		speaker, ready, speakerErr = oto.NewContext(speakerRate, 1, 2)
+		if speakerErr == nil {
+			<-ready
+		}
+	})
+	if speakerErr != nil {
+		return speakerErr
+	}
+
+	var pcm bytes.Buffer
+	binary.Write(&pcm, binary.LittleEndian, tts.Gain(speech.Resample(speakerRate), player.volume))
+	output := speaker.NewPlayer(&pcm)
+	output.Play()
+	for output.IsPlaying() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return output.Close()
+}
+
+// synthesize and speak an announcement on local audio, with mplayer
+// not supporting volume
+func speak(ctx osip.Agent, item announcement) error {
+	config := current()
+	text, options, volume := voice(item)
+	fileName, err := config.engine.Synthesize(text, options)
+	if err != nil {
+		return err
+	}
+
+	var player handlers.PlayerInterface = &nativePlayer{volume: volume}
+	if !config.Native {
+		player = &handlers.MPlayer{}
+	}
+	setSpeaking(ctx, true)
+	defer setSpeaking(ctx, false)
+	return player.Play(fileName)
+}
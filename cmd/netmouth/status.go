@@ -0,0 +1,91 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sync"
+
+	"babylon/internal/service"
+
+	osip "babylon/internal/exosip2"
+)
+
+// speaking state published to blf and presence subscribers
+var (
+	speaking     = false
+	stateVersion = 0
+	speakerLock  sync.Mutex
+)
+
+// current state document for an event package
+func stateBody(ctx osip.Agent, pkg string) (string, []byte) {
+	speakerLock.Lock()
+	defer speakerLock.Unlock()
+	return speakerState(ctx, pkg)
+}
+
+// state document with speakerLock held
+func speakerState(ctx osip.Agent, pkg string) (string, []byte) {
+	entity := ctx.GetIdentity()
+	switch pkg {
+	case "dialog":
+		state := ""
+		if speaking {
+			state = "confirmed"
+		}
+		return osip.DIALOG_CONTENT, osip.DialogBody(entity, stateVersion, state)
+	case "presence":
+		note := "idle"
+		if speaking {
+			note = "speaking"
+		}
+		return osip.PIDF_CONTENT, osip.PresenceBody(entity, true, note)
+	}
+	return "", nil
+}
+
+// change speaking state and notify subscribers, under the lock so
+// notifications go out in state order
+func setSpeaking(ctx osip.Agent, active bool) {
+	speakerLock.Lock()
+	defer speakerLock.Unlock()
+	if speaking == active {
+		return
+	}
+	speaking = active
+	stateVersion++
+	for _, pkg := range []string{"dialog", "presence"} {
+		content, body := speakerState(ctx, pkg)
+		ctx.Publish(pkg, content, body)
+	}
+}
+
+// accept blf and presence subscriptions with current state
+func subscribe(event *osip.Event) {
+	content, body := stateBody(event.Context, event.Package)
+	if body == nil {
+		event.Reply(osip.SIP_BAD_EVENT)
+		return
+	}
+
+	event.Reply(osip.SIP_OK)
+	err := event.Context.Notify(event.Dialog, osip.SUB_ACTIVE, content, body)
+	if err != nil {
+		service.Error(err)
+		return
+	}
+	service.Debug(2, "subscribed ", event.Package, " from ", event.From)
+}
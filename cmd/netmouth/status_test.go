@@ -0,0 +1,64 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	osip "babylon/internal/exosip2"
+)
+
+var dialogVersion = regexp.MustCompile(`<dialog-info [^>]*version="([0-9]+)"`)
+
+func TestSetSpeaking(t *testing.T) {
+	h := newHarness(t, Config{})
+	h.send(t, osip.Event{Type: osip.EVT_SUBSCRIBE, Method: "SUBSCRIBE", Package: "dialog", From: "sip:alice@example.com", Call: -1, Dialog: 7})
+	base := len(h.mock.Replies())
+
+	// concurrent changes still notify in version order
+	var active sync.WaitGroup
+	for count := 0; count < 64; count++ {
+		active.Add(1)
+		go func(on bool) {
+			defer active.Done()
+			setSpeaking(h.mock, on)
+		}(count%2 == 0)
+	}
+	active.Wait()
+	setSpeaking(h.mock, false)
+
+	last := -1
+	for _, reply := range h.mock.Replies()[base:] {
+		if reply.Method != "NOTIFY" || reply.Dialog != 7 {
+			continue
+		}
+		found := dialogVersion.FindSubmatch(reply.Body)
+		if found == nil {
+			t.Fatalf("no version in %s", reply.Body)
+		}
+		version, _ := strconv.Atoi(string(found[1]))
+		if version <= last {
+			t.Fatalf("version %d notified after %d", version, last)
+		}
+		last = version
+	}
+	if last != stateVersion {
+		t.Fatalf("last notified version %d, state version %d", last, stateVersion)
+	}
+}
@@ -5,6 +5,8 @@ go 1.17
 require (
 	github.com/alexflint/go-arg v1.4.3
 	github.com/coreos/go-systemd v0.0.0-20191104093116-d3cd4ed1dbcf
+	github.com/hajimehoshi/go-mp3 v0.3.3
+	github.com/hajimehoshi/oto/v2 v2.2.0
 	github.com/hegedustibor/htgo-tts v0.0.0-20230402053941-cd8d1a158135
 	github.com/percivalalb/sipuri v0.3.0
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
@@ -13,7 +15,5 @@ require (
 
 require (
 	github.com/alexflint/go-scalar v1.1.0 // indirect
-	github.com/hajimehoshi/go-mp3 v0.3.3 // indirect
-	github.com/hajimehoshi/oto/v2 v2.2.0 // indirect
 	golang.org/x/sys v0.9.0 // indirect
 )
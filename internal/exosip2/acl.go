@@ -0,0 +1,119 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// access rules of one list
+type rules struct {
+	uris    []string
+	domains []string
+}
+
+// ACL filters inbound requests by from uri pattern and from domain.  Deny
+// rules are checked first, and if any allow rules exist a request must
+// match one of them.  There are no address rules, as eXosip does not report
+// the address a request came from, and the via a client sends can be
+// forged.
+type ACL struct {
+	allow rules
+	deny  rules
+}
+
+// NewACL parses comma separated allow and deny lists.  Entries may be a
+// uri pattern such as sip:*@pbx.local, or a domain.  An ip or cidr is an
+// error rather than a rule that cannot be enforced.
+func NewACL(allow, deny string) (*ACL, error) {
+	acl := &ACL{}
+	if err := acl.allow.parse(allow); err != nil {
+		return nil, err
+	}
+	if err := acl.deny.parse(deny); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func (list *rules) parse(text string) error {
+	for _, entry := range strings.Split(text, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case len(entry) < 1:
+			continue
+		case strings.Contains(entry, "/") || net.ParseIP(entry) != nil:
+			return fmt.Errorf("unsupported acl address %s", entry)
+		case strings.ContainsAny(entry, "@*?[") || strings.HasPrefix(entry, "sip:") || strings.HasPrefix(entry, "sips:"):
+			if _, err := path.Match(entry, ""); err != nil {
+				return fmt.Errorf("invalid acl pattern %s", entry)
+			}
+			list.uris = append(list.uris, entry)
+		default:
+			list.domains = append(list.domains, strings.TrimPrefix(entry, "."))
+		}
+	}
+	return nil
+}
+
+func (list *rules) empty() bool {
+	return len(list.uris) < 1 && len(list.domains) < 1
+}
+
+func (list *rules) match(from string) bool {
+	from = strings.ToLower(from)
+	address := from
+	if pos := strings.IndexByte(from, ':'); pos > -1 {
+		address = from[pos+1:]
+	}
+	for _, pattern := range list.uris {
+		target := address
+		if strings.HasPrefix(pattern, "sip:") || strings.HasPrefix(pattern, "sips:") {
+			target = from
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+
+	host := address
+	if pos := strings.IndexByte(host, '@'); pos > -1 {
+		host = host[pos+1:]
+	}
+	if pos := strings.IndexAny(host, ":;"); pos > -1 {
+		host = host[:pos]
+	}
+	for _, domain := range list.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Permit checks if a request from a uri is allowed
+func (acl *ACL) Permit(from string) bool {
+	if acl == nil {
+		return true
+	}
+	if acl.deny.match(from) {
+		return false
+	}
+	return acl.allow.empty() || acl.allow.match(from)
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import "testing"
+
+func TestACL(t *testing.T) {
+	tests := []struct {
+		allow string
+		deny  string
+		from  string
+		want  bool
+	}{
+		{"", "", "sip:alice@example.com", true},
+		{"example.com", "", "sip:alice@example.com", true},
+		{"example.com", "", "sip:alice@pbx.example.com", true},
+		{"example.com", "", "sip:alice@badexample.com", false},
+		{"example.com", "", "", false},
+		{"*@pbx.local", "", "sip:alice@pbx.local", true},
+		{"*@pbx.local", "", "sip:alice@other.local", false},
+		{"sip:*@pbx.local", "", "sips:alice@pbx.local", false},
+		{"example.com", "sip:bot@example.com", "sip:bot@example.com", false},
+		{"", "spam.example.com", "sip:bot@spam.example.com;tag=1", false},
+		{"example.com", "", "SIP:Alice@Example.COM", true},
+	}
+	for _, test := range tests {
+		acl, err := NewACL(test.allow, test.deny)
+		if err != nil {
+			t.Fatalf("allow=%q deny=%q: %v", test.allow, test.deny, err)
+		}
+		if got := acl.Permit(test.from); got != test.want {
+			t.Errorf("allow=%q deny=%q permit(%q) = %v, want %v", test.allow, test.deny, test.from, got, test.want)
+		}
+	}
+
+	var none *ACL
+	if !none.Permit("sip:alice@example.com") {
+		t.Error("nil acl should permit")
+	}
+}
+
+func TestACLInvalid(t *testing.T) {
+	for _, allow := range []string{"10.0.0.0/8", "192.168.1.1", "::1", "10.0.0.0/33", "sip:[alice"} {
+		if _, err := NewACL(allow, ""); err == nil {
+			t.Errorf("%q: expected error", allow)
+		}
+	}
+}
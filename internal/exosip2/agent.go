@@ -0,0 +1,261 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package exosip2 binds libeXosip2 for sip user agents.  The nosip build
+// tag, or building without cgo, leaves out the library bindings, so that the
+// Mock agent, router, and other pure go parts can be built and tested where
+// eXosip2 is not installed, as with "go test -tags nosip ./internal/exosip2".
+package exosip2
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// basic server config
+	Agent   string
+	Ipv6    bool
+	Tcp     bool
+	Timeout int
+
+	// options ping of server route in seconds, 0 to disable
+	Keepalive int
+
+	// maximum seconds between registration retries, default 300
+	Backoff int
+
+	// seconds to drain pending transactions on shutdown, default 5
+	Drain int
+
+	// credentials, refresh set if login
+	Refresh  int
+	Server   string
+	Allows   string
+	Accepts  string
+	Encoding string
+
+	// nat traversal, public address as host or host:port, stun server
+	// host:port for udp, and udp keepalive in seconds
+	Public       string
+	Stun         string
+	Rport        bool
+	NatKeepalive int
+
+	// inbound request limits per second, 0 for none, and what to do
+	// when the event channel is full
+	Rate        float64
+	Burst       int
+	SourceRate  float64
+	SourceBurst int
+	Overflow    OVERFLOW
+
+	// tls transport, enabled by certificate or sips server
+	Certificate string
+	PrivateKey  string
+	Authority   string
+	Verify      bool
+}
+
+// registration state of an identity
+type registration struct {
+	rid      int
+	identity string
+	username string
+	password string
+	refresh  int
+	expires  int // refresh after any 423 min-expires
+	online   bool
+	fails    int
+	attempt  int       // retries since last success
+	retry    time.Time // next retry, zero if none scheduled
+	failures int       // total failures
+	success  time.Time
+	failure  time.Time
+}
+
+// RegistrationState is a copy of the state of one registration
+type RegistrationState struct {
+	Identity    string
+	Username    string
+	Online      bool
+	Expires     int
+	Attempt     int
+	Failures    int
+	Retry       time.Time
+	LastSuccess time.Time
+	LastFailure time.Time
+}
+
+// Snapshot is a consistent copy of agent state, safe to use from any
+// goroutine such as signal handlers and status endpoints.
+type Snapshot struct {
+	Open          bool
+	Address       string
+	Public        string // masquerade contact address, if any
+	Route         string
+	Identity      string // primary identity
+	Reachable     bool
+	Latency       time.Duration
+	Registrations []RegistrationState // sorted by identity
+	Pending       int                 // unregistrations and messages in flight
+	Watchers      int
+	Subscriptions int
+	Limited       int // requests refused by rate limits
+	Overflows     int // requests not delivered to a full event channel
+	Timestamp     time.Time
+}
+
+func (reg *registration) snapshot() RegistrationState {
+	return RegistrationState{Identity: reg.identity, Username: reg.username, Online: reg.online, Expires: reg.expires, Attempt: reg.attempt, Failures: reg.failures, Retry: reg.retry, LastSuccess: reg.success, LastFailure: reg.failure}
+}
+
+// Agent is the sip user agent api of a Context.  It is also implemented
+// by Mock so event handlers can be tested without libeXosip2.
+type Agent interface {
+	Register(identity, user, secret string) error
+	RegisterRefresh(identity, user, secret string, refresh int) error
+	Unregister()
+	UnregisterIdentity(identity string)
+	ListenAndServe(address string, out chan<- Event) error
+	ListenAndServeContext(parent context.Context, address string, out chan<- Event) error
+	Close()
+	Reply(event *Event, status SIP_STATUS)
+	SetRoute(route string) bool
+	SetAuthenticator(realm string, lookup Lookup)
+	SetACL(acl *ACL)
+	SendMessage(to, from, contentType string, body []byte) (int, error)
+	Invite(to, from, content string, body []byte) (int, error)
+	Answer(tid int, status SIP_STATUS, content string, body []byte) error
+	Ringing(tid int) error
+	Reject(tid int, status SIP_STATUS) error
+	Hangup(cid, did int) error
+	SendDTMF(did int, digit string, duration time.Duration) error
+	Transfer(did int, target string) error
+	AttendedTransfer(did, consult int) error
+	TransferStatus(did int, status SIP_STATUS) error
+	Redirect(event *Event, contacts ...string) error
+	Subscribe(to, from, pkg string, expires int) (int, error)
+	Unsubscribe(sid int) error
+	Notify(did int, state SUB_STATE, content string, body []byte) error
+	Publish(pkg, content string, body []byte) int
+	GetAddress() string
+	GetIdentity() string
+	GetIdentities() []string
+	GetSchema() string
+	IsOpen() bool
+	IsActive() bool
+	IsOnline() bool
+	IsRegistered(identity string) bool
+	IsReachable() bool
+	GetLatency() time.Duration
+	Snapshot() Snapshot
+}
+
+type Event struct {
+	Context      Agent
+	Type         EVT_TYPE
+	Status       SIP_STATUS
+	Method       string
+	Uri          string              // request uri
+	Source       string              // reported source address, not verified
+	Headers      map[string][]string // by lower case name
+	Content      string
+	Body         []byte
+	Parts        []Part // decoded body parts of messages and notify
+	Call         int
+	Tran         int
+	Dialog       int
+	From         string
+	To           string
+	Display      string
+	Subject      string
+	Expires      int
+	Identity     string        // registration an event is for
+	User         string        // authenticated digest user
+	Package      string        // event package of subscribe and notify
+	Subscription int           // client subscription id
+	Latency      time.Duration // round trip of peer options ping
+	Attempt      int           // registration retry attempt
+	Retry        time.Duration // delay until next registration retry
+	Digit        string        // dtmf digit of an info request
+	Duration     time.Duration // dtmf digit duration, 0 if unknown
+	Target       string        // refer-to target of a transfer
+	Replaces     string        // dialog replaced by an attended transfer
+	Timestamp    time.Time
+}
+
+// Reply to a received request event thru it's agent
+func (event *Event) Reply(status SIP_STATUS) {
+	event.Status = status
+	if event.Context != nil {
+		event.Context.Reply(event, status)
+	}
+}
+
+// Header finds the first value of a header by name
+func (event *Event) Header(name string) string {
+	values := event.Headers[strings.ToLower(name)]
+	if len(values) < 1 {
+		return ""
+	}
+	return values[0]
+}
+
+// HeaderValues finds all values of a header by name
+func (event *Event) HeaderValues(name string) []string {
+	return event.Headers[strings.ToLower(name)]
+}
+
+// CustomHeaders are x- extension headers, such as inserted by a pbx
+func (event *Event) CustomHeaders() map[string][]string {
+	custom := make(map[string][]string)
+	for name, values := range event.Headers {
+		if strings.HasPrefix(name, "x-") {
+			custom[name] = values
+		}
+	}
+	return custom
+}
+
+func (event *Event) CallId() string {
+	return event.Header("call-id")
+}
+
+func (event *Event) CSeq() string {
+	return event.Header("cseq")
+}
+
+func (event *Event) Via() []string {
+	return event.HeaderValues("via")
+}
+
+func (event *Event) Contact() string {
+	return event.Header("contact")
+}
+
+// Contacts of a request or a redirect response
+func (event *Event) Contacts() []string {
+	return event.HeaderValues("contact")
+}
+
+func (event *Event) UserAgent() string {
+	return event.Header("user-agent")
+}
+
+func (event *Event) Priority() string {
+	return event.Header("priority")
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lookup finds the secret of a user for inbound digest authentication
+type Lookup func(username string) (secret string, ok bool)
+
+// lifetime of a challenge nonce, after which it is stale, and most nonces
+// held at once
+const (
+	nonceExpires = 5 * time.Minute
+	maxNonces    = 4096
+)
+
+// issued challenge nonce and the highest nonce count used with it
+type nonceState struct {
+	issued time.Time
+	count  uint64
+}
+
+// remember an issued nonce, dropping expired ones, and the oldest when
+// full so an unauthenticated flood cannot grow the table
+func issueNonce(nonces map[string]*nonceState, nonce string, now time.Time) {
+	oldest := ""
+	for key, state := range nonces {
+		if now.Sub(state.issued) > 2*nonceExpires {
+			delete(nonces, key)
+		} else if len(oldest) < 1 || state.issued.Before(nonces[oldest].issued) {
+			oldest = key
+		}
+	}
+	if len(nonces) >= maxNonces {
+		delete(nonces, oldest)
+	}
+	nonces[nonce] = &nonceState{issued: now}
+}
+
+// digest credentials of a request
+type digest struct {
+	username  string
+	realm     string
+	nonce     string
+	uri       string
+	response  string
+	algorithm string
+	cnonce    string
+	qop       string
+	nc        string
+}
+
+func md5hex(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(sum[:])
+}
+
+func unquote(value string) string {
+	return strings.Trim(value, "\"")
+}
+
+// verify digest response for a request method and user secret
+func (auth *digest) verify(method, secret string) bool {
+	if len(auth.algorithm) > 0 && !strings.EqualFold(auth.algorithm, "md5") {
+		return false
+	}
+
+	// only qop=auth is offered, the body is not protected
+	if len(auth.qop) > 0 && !strings.EqualFold(auth.qop, "auth") {
+		return false
+	}
+
+	ha1 := md5hex(auth.username, auth.realm, secret)
+	ha2 := md5hex(method, auth.uri)
+	expected := md5hex(ha1, auth.nonce, ha2)
+	if len(auth.qop) > 0 {
+		expected = md5hex(ha1, auth.nonce, auth.nc, auth.cnonce, auth.qop, ha2)
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(auth.response))) == 1
+}
+
+// check the nonce count is strictly increasing to prevent replay, and
+// record it.  Without qop there is no count and the nonce is single use.
+func (auth *digest) counted(state *nonceState) bool {
+	count := uint64(1)
+	if len(auth.qop) > 0 {
+		value, err := strconv.ParseUint(auth.nc, 16, 64)
+		if err != nil {
+			return false
+		}
+		count = value
+	}
+	if count <= state.count {
+		return false
+	}
+	state.count = count
+	return true
+}
+
+func createNonce() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+func challengeHeader(realm, nonce string, stale bool) string {
+	header := fmt.Sprintf("Digest realm=\"%s\", nonce=\"%s\", algorithm=MD5, qop=\"auth\"", realm, nonce)
+	if stale {
+		header += ", stale=true"
+	}
+	return header
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// digest credentials as a client would compute them
+func credentials(qop, nc, secret string) *digest {
+	auth := &digest{username: "alice", realm: "example.com", nonce: "abc", uri: "sip:bob@example.com", cnonce: "xyz", qop: qop, nc: nc}
+	ha1 := md5hex(auth.username, auth.realm, secret)
+	ha2 := md5hex("MESSAGE", auth.uri)
+	auth.response = md5hex(ha1, auth.nonce, ha2)
+	if len(qop) > 0 {
+		auth.response = md5hex(ha1, auth.nonce, nc, auth.cnonce, qop, ha2)
+	}
+	return auth
+}
+
+func TestDigestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		auth *digest
+		want bool
+	}{
+		{"qop auth", credentials("auth", "00000001", "secret"), true},
+		{"no qop", credentials("", "", "secret"), true},
+		{"wrong secret", credentials("auth", "00000001", "guess"), false},
+		{"auth-int", credentials("auth-int", "00000001", "secret"), false},
+	}
+	for _, test := range tests {
+		if got := test.auth.verify("MESSAGE", "secret"); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDigestCounted(t *testing.T) {
+	tests := []struct {
+		qop  string
+		nc   string
+		want bool
+	}{
+		{"auth", "00000001", true},
+		{"auth", "00000001", false},
+		{"auth", "00000003", true},
+		{"auth", "00000002", false},
+		{"auth", "zz", false},
+	}
+	state := &nonceState{}
+	for _, test := range tests {
+		auth := &digest{qop: test.qop, nc: test.nc}
+		if got := auth.counted(state); got != test.want {
+			t.Errorf("nc %s: got %v, want %v", test.nc, got, test.want)
+		}
+	}
+
+	single := &nonceState{}
+	auth := &digest{}
+	if !auth.counted(single) || auth.counted(single) {
+		t.Error("nonce without qop should be single use")
+	}
+}
+
+func TestIssueNonce(t *testing.T) {
+	nonces := make(map[string]*nonceState)
+	now := time.Now()
+	issueNonce(nonces, "expired", now.Add(-3*nonceExpires))
+	for count := 0; count < maxNonces+10; count++ {
+		issueNonce(nonces, fmt.Sprintf("n%d", count), now.Add(time.Duration(count)*time.Millisecond))
+	}
+	if len(nonces) != maxNonces {
+		t.Fatalf("holding %d nonces, want %d", len(nonces), maxNonces)
+	}
+	if _, ok := nonces["expired"]; ok {
+		t.Error("expired nonce kept")
+	}
+	if _, ok := nonces["n9"]; ok {
+		t.Error("oldest nonce kept")
+	}
+	if _, ok := nonces[fmt.Sprintf("n%d", maxNonces+9)]; !ok {
+		t.Error("newest nonce dropped")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// set a message body and content type on an outgoing sip message
+func setBody(msg *C.osip_message_t, content string, body []byte) {
+	if msg == nil || len(body) < 1 {
+		return
+	}
+
+	cs_body := C.CBytes(body)
+	defer C.free(cs_body)
+	C.osip_message_set_body(msg, (*C.char)(cs_body), C.size_t(len(body)))
+	if len(content) > 0 {
+		cs_content := C.CString(content)
+		defer C.free(unsafe.Pointer(cs_content))
+		C.osip_message_set_content_type(msg, cs_content)
+	}
+}
+
+// Invite places an outbound call thru the current route, usually with an
+// sdp offer.  The call id returned matches later call events.
+func (ctx *Context) Invite(to, from, content string, body []byte) (int, error) {
+	if len(from) < 1 {
+		from = ctx.GetIdentity()
+	}
+	if len(to) < 1 || len(from) < 1 {
+		return -1, fmt.Errorf("call address incomplete")
+	}
+
+	cs_to := C.CString(to)
+	cs_from := C.CString(from)
+	defer C.free(unsafe.Pointer(cs_to))
+	defer C.free(unsafe.Pointer(cs_from))
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	cs_route := ctx.looseRoute()
+	defer C.free(unsafe.Pointer(cs_route))
+	var msg *C.osip_message_t
+	result := int(C.eXosip_call_build_initial_invite(ctx.context, &msg, cs_to, cs_from, cs_route, nil))
+	if result != 0 {
+		return -1, fmt.Errorf("call invite failed; code=%d", result)
+	}
+	setBody(msg, content, body)
+	cid := int(C.eXosip_call_send_initial_invite(ctx.context, msg))
+	if cid < 0 {
+		return -1, fmt.Errorf("call invite failed; code=%d", cid)
+	}
+	return cid, nil
+}
+
+// Answer an inbound call transaction, such as with 200 and an sdp body
+func (ctx *Context) Answer(tid int, status SIP_STATUS, content string, body []byte) error {
+	if tid < 0 {
+		return fmt.Errorf("invalid call transaction")
+	}
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	var msg *C.osip_message_t
+	result := int(C.eXosip_call_build_answer(ctx.context, C.int(tid), C.int(status), &msg))
+	if result != 0 {
+		return fmt.Errorf("call answer failed; code=%d", result)
+	}
+	setBody(msg, content, body)
+	result = int(C.eXosip_call_send_answer(ctx.context, C.int(tid), C.int(status), msg))
+	if result != 0 {
+		return fmt.Errorf("call answer failed; code=%d", result)
+	}
+	return nil
+}
+
+// Ringing notifies the caller with 180 for an inbound call transaction
+func (ctx *Context) Ringing(tid int) error {
+	return ctx.Answer(tid, SIP_RINGING, "", nil)
+}
+
+// Reject an inbound call transaction with an error status
+func (ctx *Context) Reject(tid int, status SIP_STATUS) error {
+	if status < 300 {
+		return fmt.Errorf("invalid reject status %d", status)
+	}
+	return ctx.Answer(tid, status, "", nil)
+}
+
+// Hangup sends cancel or bye for a call based on it's dialog state
+func (ctx *Context) Hangup(cid, did int) error {
+	if cid < 0 {
+		return fmt.Errorf("invalid call")
+	}
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	result := int(C.eXosip_call_terminate(ctx.context, C.int(cid), C.int(did)))
+	if result != 0 {
+		return fmt.Errorf("call hangup failed; code=%d", result)
+	}
+	return nil
+}
+
+// SendDTMF sends a digit as an info request within a call dialog
+func (ctx *Context) SendDTMF(did int, digit string, duration time.Duration) error {
+	if did < 0 {
+		return fmt.Errorf("invalid call dialog")
+	}
+	body, err := dtmfRelay(digit, duration)
+	if err != nil {
+		return err
+	}
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	var msg *C.osip_message_t
+	result := int(C.eXosip_call_build_info(ctx.context, C.int(did), &msg))
+	if result != 0 {
+		return fmt.Errorf("call info failed; code=%d", result)
+	}
+	setBody(msg, DTMF_RELAY_CONTENT, body)
+	result = int(C.eXosip_call_send_request(ctx.context, C.int(did), msg))
+	if result != 0 {
+		return fmt.Errorf("call info failed; code=%d", result)
+	}
+	return nil
+}
+
+// answer an inbound info request, true if it carried a digit
+func (ctx *Context) dtmf(event *Event) bool {
+	if len(event.Body) < 1 {
+		event.Reply(SIP_OK)
+		return false
+	}
+
+	digit, duration, err := parseDTMF(event.Content, event.Body)
+	if err != nil {
+		event.Reply(SIP_UNSUPPORTED_MEDIA)
+		return false
+	}
+	event.Digit = digit
+	event.Duration = duration
+	event.Reply(SIP_OK)
+	return true
+}
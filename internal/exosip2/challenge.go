@@ -0,0 +1,122 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// SetAuthenticator enables digest authentication of inbound requests
+// for a realm.  A nil lookup disables authentication.
+func (ctx *Context) SetAuthenticator(realm string, lookup Lookup) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.realm = realm
+	ctx.lookup = lookup
+}
+
+// digest authorization of a request, or nil if none
+func authorization(msg *C.osip_message_t) *digest {
+	var auth *C.osip_authorization_t
+	if C.osip_message_get_authorization(msg, 0, &auth) < 0 || auth == nil {
+		return nil
+	}
+
+	field := func(value *C.char) string {
+		if value == nil {
+			return ""
+		}
+		return unquote(C.GoString(value))
+	}
+	return &digest{
+		username:  field(auth.username),
+		realm:     field(auth.realm),
+		nonce:     field(auth.nonce),
+		uri:       field(auth.uri),
+		response:  field(auth.response),
+		algorithm: field(auth.algorithm),
+		cnonce:    field(auth.cnonce),
+		qop:       field(auth.message_qop),
+		nc:        field(auth.nonce_count),
+	}
+}
+
+// verify credentials of an inbound request, challenging if missing or
+// invalid.  Returns true if the request may be delivered.
+func (ctx *Context) authorized(request *C.osip_message_t, event *Event) bool {
+	ctx.Lock()
+	realm, lookup := ctx.realm, ctx.lookup
+	ctx.Unlock()
+	if lookup == nil {
+		return true
+	}
+
+	stale := false
+	auth := authorization(request)
+	if auth != nil && auth.realm == realm && strings.EqualFold(auth.uri, event.Uri) {
+		ctx.Lock()
+		_, ok := ctx.nonces[auth.nonce]
+		ctx.Unlock()
+		secret, found := lookup(auth.username)
+		if ok && found && auth.verify(event.Method, secret) {
+			fresh, counted := ctx.useNonce(auth)
+			if fresh && counted {
+				event.User = auth.username
+				return true
+			}
+			stale = !fresh
+		}
+	}
+	ctx.challenge(event, realm, stale)
+	return false
+}
+
+// check a verified nonce is still fresh and it's count was not replayed
+func (ctx *Context) useNonce(auth *digest) (bool, bool) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	state, ok := ctx.nonces[auth.nonce]
+	if !ok || time.Since(state.issued) >= nonceExpires {
+		return false, false
+	}
+	return true, auth.counted(state)
+}
+
+// send 401 with a new nonce
+func (ctx *Context) challenge(event *Event, realm string, stale bool) {
+	nonce := createNonce()
+	cs_header := C.CString(challengeHeader(realm, nonce, stale))
+	defer C.free(unsafe.Pointer(cs_header))
+
+	event.Status = SIP_UNAUTHORIZED
+	now := time.Now()
+	ctx.Lock()
+	issueNonce(ctx.nonces, nonce, now)
+	msg := ctx.makeReply(event)
+	if msg != nil {
+		C.osip_message_set_www_authenticate(msg, cs_header)
+	}
+	ctx.Unlock()
+	ctx.sendReply(event, msg)
+}
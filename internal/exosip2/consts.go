@@ -103,3 +103,11 @@ const (
 
 	SIP_UNKNOWN SIP_STATUS = 999
 )
+
+type SUB_STATE int
+
+const (
+	SUB_PENDING    SUB_STATE = 1
+	SUB_ACTIVE     SUB_STATE = 2
+	SUB_TERMINATED SUB_STATE = 3
+)
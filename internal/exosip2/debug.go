@@ -28,5 +28,28 @@ const (
 	EVT_SHUTDOWN EVT_TYPE = "shutdown"
 	EVT_INVALID  EVT_TYPE = "invalid"
 	EVT_REGISTER EVT_TYPE = "register"
+	EVT_RETRY    EVT_TYPE = "retry"
 	EVT_MESSAGE  EVT_TYPE = "message"
+	EVT_SENT     EVT_TYPE = "sent"
+
+	EVT_PEER_UP   EVT_TYPE = "peer-up"
+	EVT_PEER_DOWN EVT_TYPE = "peer-down"
+
+	EVT_SUBSCRIBE  EVT_TYPE = "subscribe"
+	EVT_SUBSCRIBED EVT_TYPE = "subscribed"
+	EVT_NOTIFY     EVT_TYPE = "notify"
+
+	EVT_CALL_INVITE     EVT_TYPE = "invite"
+	EVT_CALL_REINVITE   EVT_TYPE = "reinvite"
+	EVT_CALL_ACK        EVT_TYPE = "ack"
+	EVT_CALL_RINGING    EVT_TYPE = "ringing"
+	EVT_CALL_ANSWERED   EVT_TYPE = "answered"
+	EVT_CALL_FAILED     EVT_TYPE = "failed"
+	EVT_CALL_CANCELLED  EVT_TYPE = "cancelled"
+	EVT_CALL_CLOSED     EVT_TYPE = "closed"
+	EVT_CALL_RELEASED   EVT_TYPE = "released"
+	EVT_CALL_REDIRECTED EVT_TYPE = "redirected"
+	EVT_DTMF            EVT_TYPE = "dtmf"
+	EVT_REFER           EVT_TYPE = "refer"
+	EVT_TRANSFER        EVT_TYPE = "transfer"
 )
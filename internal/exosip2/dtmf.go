@@ -0,0 +1,100 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DTMF_RELAY_CONTENT = "application/dtmf-relay"
+	DTMF_CONTENT       = "application/dtmf"
+)
+
+// digits in rfc 4733 event code order
+const dtmfDigits = "0123456789*#ABCD"
+
+// default duration of a sent digit
+const dtmfDuration = 160 * time.Millisecond
+
+// map a signal value, either a digit or event code, to a digit
+func dtmfDigit(signal string) (string, error) {
+	signal = strings.ToUpper(strings.TrimSpace(signal))
+	if len(signal) == 1 && strings.Contains(dtmfDigits, signal) {
+		return signal, nil
+	}
+	code, err := strconv.Atoi(signal)
+	if err != nil || code < 0 || code >= len(dtmfDigits) {
+		return "", fmt.Errorf("invalid dtmf signal %s", signal)
+	}
+	return dtmfDigits[code : code+1], nil
+}
+
+// parse an info request body for a digit and it's duration
+func parseDTMF(content string, body []byte) (string, time.Duration, error) {
+	switch strings.ToLower(content) {
+	case DTMF_CONTENT:
+		digit, err := dtmfDigit(string(body))
+		return digit, 0, err
+	case DTMF_RELAY_CONTENT:
+	default:
+		return "", 0, fmt.Errorf("unsupported dtmf content %s", content)
+	}
+
+	digit, duration := "", time.Duration(0)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		pair := strings.SplitN(scanner.Text(), "=", 2)
+		if len(pair) < 2 {
+			continue
+		}
+		value := strings.TrimSpace(pair[1])
+		switch strings.ToLower(strings.TrimSpace(pair[0])) {
+		case "signal":
+			var err error
+			digit, err = dtmfDigit(value)
+			if err != nil {
+				return "", 0, err
+			}
+		case "duration":
+			msec, err := strconv.Atoi(value)
+			if err == nil && msec > 0 {
+				duration = time.Duration(msec) * time.Millisecond
+			}
+		}
+	}
+	if len(digit) < 1 {
+		return "", 0, fmt.Errorf("missing dtmf signal")
+	}
+	return digit, duration, nil
+}
+
+// create a dtmf-relay body for a digit
+func dtmfRelay(digit string, duration time.Duration) ([]byte, error) {
+	digit, err := dtmfDigit(digit)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		duration = dtmfDuration
+	}
+	return []byte(fmt.Sprintf("Signal=%s\r\nDuration=%d\r\n", digit, duration.Milliseconds())), nil
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDTMF(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		body     string
+		digit    string
+		duration time.Duration
+		fails    bool
+	}{
+		{"relay digit", DTMF_RELAY_CONTENT, "Signal=5\r\nDuration=250\r\n", "5", 250 * time.Millisecond, false},
+		{"relay star", DTMF_RELAY_CONTENT, "Signal=*\r\nDuration=100\r\n", "*", 100 * time.Millisecond, false},
+		{"relay event code", DTMF_RELAY_CONTENT, "Signal=11\r\nDuration=100\r\n", "#", 100 * time.Millisecond, false},
+		{"relay lower case", "Application/DTMF-Relay", "signal = d\nduration = 80\n", "D", 80 * time.Millisecond, false},
+		{"relay no duration", DTMF_RELAY_CONTENT, "Signal=1\r\n", "1", 0, false},
+		{"relay bad duration", DTMF_RELAY_CONTENT, "Signal=2\r\nDuration=long\r\n", "2", 0, false},
+		{"relay negative duration", DTMF_RELAY_CONTENT, "Signal=3\r\nDuration=-5\r\n", "3", 0, false},
+		{"relay missing signal", DTMF_RELAY_CONTENT, "Duration=250\r\n", "", 0, true},
+		{"relay empty", DTMF_RELAY_CONTENT, "", "", 0, true},
+		{"relay bad signal", DTMF_RELAY_CONTENT, "Signal=x\r\n", "", 0, true},
+		{"relay code out of range", DTMF_RELAY_CONTENT, "Signal=16\r\n", "", 0, true},
+		{"dtmf digit", DTMF_CONTENT, "7", "7", 0, false},
+		{"dtmf code", DTMF_CONTENT, " 10\r\n", "*", 0, false},
+		{"dtmf lower case", DTMF_CONTENT, "a", "A", 0, false},
+		{"dtmf empty", DTMF_CONTENT, "", "", 0, true},
+		{"unsupported", "text/plain", "Signal=5", "", 0, true},
+	}
+	for _, test := range tests {
+		digit, duration, err := parseDTMF(test.content, []byte(test.body))
+		if (err != nil) != test.fails || digit != test.digit || duration != test.duration {
+			t.Errorf("%s: got %q %v %v, want %q %v", test.name, digit, duration, err, test.digit, test.duration)
+		}
+	}
+}
+
+func TestDtmfRelay(t *testing.T) {
+	body, err := dtmfRelay("#", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digit, duration, err := parseDTMF(DTMF_RELAY_CONTENT, body)
+	if err != nil || digit != "#" || duration != dtmfDuration {
+		t.Fatalf("round trip got %q %v %v", digit, duration, err)
+	}
+	if _, err := dtmfRelay("x", 0); err == nil {
+		t.Fatal("expected invalid digit error")
+	}
+}
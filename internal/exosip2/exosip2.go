@@ -12,6 +12,7 @@
 //
 // You should have received a copy of the GNU General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
 
 package exosip2
 
@@ -22,9 +23,12 @@ package exosip2
 */
 import "C"
 import (
+	"context"
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unsafe"
 )
@@ -36,20 +40,7 @@ func boolToInt(enable bool) C.int {
 	return 0
 }
 
-type Config struct {
-	// basic server config
-	Agent   string
-	Ipv6    bool
-	Tcp     bool
-	Timeout int
-
-	// credentials, refresh set if login
-	Refresh  int
-	Server   string
-	Allows   string
-	Accepts  string
-	Encoding string
-}
+var _ Agent = (*Context)(nil)
 
 type Context struct {
 	Config
@@ -59,114 +50,301 @@ type Context struct {
 	Tls     bool
 
 	// internals...
-	closed   bool
-	active   int // actively registered (rid)
-	online   bool
-	route    *C.char
-	allow    *C.char
-	accept   *C.char
-	encoding *C.char
-	fails    int
-	timeouts bool
-	identity string
-	username string
-	password string
-}
-
-type Event struct {
-	Context   *Context
-	Type      EVT_TYPE
-	Status    SIP_STATUS
-	Content   string
-	Body      []byte
-	Call      int
-	Tran      int
-	Dialog    int
-	From      string
-	To        string
-	Display   string
-	Subject   string
-	Expires   int
-	Timestamp time.Time
+	state         sync.Mutex
+	closed        bool
+	cancel        context.CancelFunc // stops a running event loop
+	done          chan struct{}      // closed when event loop returns
+	route         *C.char
+	allow         *C.char
+	accept        *C.char
+	encoding      *C.char
+	timeouts      bool
+	pinged        time.Time
+	pings         map[string]time.Time // options pings by call id
+	probed        bool
+	reachable     bool
+	latency       time.Duration
+	watchers      map[int]*watcher // inbound subscriptions by dialog
+	subscriptions map[int]int      // client subscription dialogs by sid
+	cancelled     map[int]bool     // unsubscribed before answered, by sid
+	messages      map[string]int   // pending sent messages by call id
+	registry      map[string]*registration
+	pending       map[int]*registration // unregistering by rid
+	identity      string                // primary identity
+	public        string                // masquerade contact address
+	realm         string
+	lookup        Lookup                 // inbound digest credentials
+	nonces        map[string]*nonceState // challenge nonces issued
+	acl           *ACL
+	limits        limiter
+	limited       int // requests refused by rate limits
+	overflows     int // requests not delivered to a full channel
 }
 
+// Lock guards both the sip stack and go side context state, so state is
+// also visible to the race detector.
 func (ctx *Context) Lock() {
+	ctx.state.Lock()
 	C.eXosip_lock(ctx.context)
 }
 
 func (ctx *Context) Unlock() {
 	C.eXosip_unlock(ctx.context)
+	ctx.state.Unlock()
 }
 
 func (ctx *Context) Register(identity, user, secret string) error {
+	return ctx.RegisterRefresh(identity, user, secret, ctx.Refresh)
+}
+
+// RegisterRefresh registers an identity with it's own refresh interval,
+// independent of other registrations.
+func (ctx *Context) RegisterRefresh(identity, user, secret string, refresh int) error {
+	ctx.Lock()
+	defer ctx.Unlock()
+
 	// if no change, skip...
-	if ctx.active != -1 && user == ctx.username && secret == ctx.password {
+	reg, ok := ctx.registry[identity]
+	if ok && user == reg.username && secret == reg.password && refresh == reg.refresh {
 		return nil
 	}
+	if ok {
+		ctx.unregister(reg)
+	}
 
-	ctx.Unregister()
-	ctx.Lock()
-	defer ctx.Unlock()
+	reg = &registration{rid: -1, identity: identity, username: user, password: secret, refresh: refresh, expires: refresh}
+	ctx.registry[identity] = reg
+	ctx.credentials()
+	if ctx.sendRegister(reg) < 0 {
+		delete(ctx.registry, identity)
+		ctx.credentials()
+		return fmt.Errorf("registration failed; code=%d", reg.rid)
+	}
+	if len(ctx.registry) == 1 || len(ctx.identity) < 1 {
+		ctx.identity = identity
+	}
+	return nil
+}
+
+// send initial register for a registration, lock must be held
+func (ctx *Context) sendRegister(reg *registration) int {
+	cs_identity := C.CString(reg.identity)
+	defer C.free(unsafe.Pointer(cs_identity))
+	reg.rid = int(C.register_identity(ctx.context, cs_identity, ctx.route, C.int(reg.expires), ctx.allow, ctx.accept, ctx.encoding))
+	return reg.rid
+}
+
+// integer value of a named header, or -1 if missing
+func headerInt(msg *C.osip_message_t, name string) int {
+	if msg == nil {
+		return -1
+	}
+	cs_name := C.CString(name)
+	defer C.free(unsafe.Pointer(cs_name))
+	return int(C.get_header_int(msg, cs_name))
+}
+
+// string value of a named header, or empty if missing
+func headerString(msg *C.osip_message_t, name string) string {
+	if msg == nil {
+		return ""
+	}
+	cs_name := C.CString(name)
+	defer C.free(unsafe.Pointer(cs_name))
+	value := C.get_header(msg, cs_name)
+	if value == nil {
+		return ""
+	}
+	return C.GoString(value)
+}
+
+// reset credentials for all registrations, including unregistrations
+// still awaiting a final response, lock must be held
+func (ctx *Context) credentials() {
 	C.eXosip_clear_authentication_info(ctx.context)
-	if len(secret) > 0 {
-		cs_user := C.CString(user)
-		cs_secret := C.CString(secret)
-		defer C.free(unsafe.Pointer(cs_user))
-		defer C.free(unsafe.Pointer(cs_secret))
+	users := make(map[string]bool)
+	add := func(reg *registration) {
+		if len(reg.password) < 1 || users[reg.username] {
+			return
+		}
+		users[reg.username] = true
+		cs_user := C.CString(reg.username)
+		cs_secret := C.CString(reg.password)
 		C.add_credentials(ctx.context, cs_user, cs_secret)
+		C.free(unsafe.Pointer(cs_user))
+		C.free(unsafe.Pointer(cs_secret))
 	}
-	cs_identity := C.CString(identity)
-	defer C.free(unsafe.Pointer(cs_identity))
-	ctx.active = int(C.register_identity(ctx.context, cs_identity, ctx.route, C.int(ctx.Refresh), ctx.allow, ctx.accept, ctx.encoding))
-	if ctx.active > -1 {
-		ctx.username = user
-		ctx.password = secret
-		ctx.identity = identity
-		return nil
+	for _, reg := range ctx.registry {
+		add(reg)
+	}
+	for _, reg := range ctx.pending {
+		add(reg)
 	}
-	err := fmt.Errorf("registration failed; code=%d", ctx.active)
-	ctx.active = -1
-	return err
 }
 
+// send unregister and wait for response, lock must be held
+func (ctx *Context) unregister(reg *registration) {
+	C.sip_unregister(ctx.context, C.int(reg.rid))
+	delete(ctx.registry, reg.identity)
+	reg.fails = 0
+	ctx.pending[reg.rid] = reg
+	if ctx.identity == reg.identity {
+		ctx.identity = ""
+	}
+}
+
+// Unregister all registered identities
 func (ctx *Context) Unregister() {
-	if ctx.active == -1 {
-		return
+	ctx.Lock()
+	defer ctx.Unlock()
+	for _, reg := range ctx.registry {
+		ctx.unregister(reg)
 	}
+}
 
+// UnregisterIdentity removes one registration, leaving others active
+func (ctx *Context) UnregisterIdentity(identity string) {
 	ctx.Lock()
 	defer ctx.Unlock()
-	C.sip_unregister(ctx.context, C.int(ctx.active))
-	ctx.active = -1
-	ctx.fails = 0
+	reg, ok := ctx.registry[identity]
+	if ok {
+		ctx.unregister(reg)
+	}
+}
+
+// registration success, returns true if event should be delivered
+func (ctx *Context) registered(evt *C.eXosip_event_t, event *Event) bool {
+	ctx.Lock()
+	defer ctx.Unlock()
+	reg, removed := ctx.findRegistration(int(evt.rid))
+	if reg == nil {
+		return false
+	}
+
+	reg.fails = 0
+	reg.attempt = 0
+	reg.retry = time.Time{}
+	reg.success = time.Now()
+	event.Identity = reg.identity
+	if removed {
+		ctx.removed(reg, event)
+		return true
+	}
+	if reg.online {
+		return false
+	}
+	reg.online = true
+	event.Expires = reg.expires
+	event.Body, event.Content = create_body(evt.response, 0)
+	return true
+}
+
+// final response to an unregister, lock must be held
+func (ctx *Context) removed(reg *registration, event *Event) {
+	delete(ctx.pending, reg.rid)
+	C.eXosip_register_remove(ctx.context, C.int(reg.rid))
+	ctx.credentials()
+	event.Expires = 0
 }
 
+// registration failure, returns true if event should be delivered
+func (ctx *Context) unregistered(evt *C.eXosip_event_t, event *Event) bool {
+	ctx.Lock()
+	defer ctx.Unlock()
+	reg, removed := ctx.findRegistration(int(evt.rid))
+	if reg == nil {
+		return false
+	}
+
+	event.Identity = reg.identity
+	reg.fails++
+	if reg.fails < 2 && (event.Status == SIP_UNAUTHORIZED || event.Status == SIP_PROXY_AUTH_REQUIRED) {
+		C.eXosip_default_action(ctx.context, evt)
+		return false
+	}
+	if removed {
+		ctx.removed(reg, event)
+		return true
+	}
+	reg.online = false
+	reg.failures++
+	reg.failure = time.Now()
+	ctx.backoff(reg, evt.response, event)
+	return true
+}
+
+// Close stops a running event loop, waiting for it to drain, and then
+// releases the sip stack.  Without a running loop it unregisters first.
 func (ctx *Context) Close() {
-	if !ctx.closed {
-		ctx.closed = true
-		ctx.Unregister()
-		for ctx.online {
-			time.Sleep(time.Second)
-		}
-		C.eXosip_quit(ctx.context)
-		C.release(unsafe.Pointer(ctx.context))
+	ctx.Lock()
+	if ctx.closed {
+		ctx.Unlock()
+		return
+	}
+	ctx.closed = true
+	cancel, done := ctx.cancel, ctx.done
+	ctx.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	} else {
+		ctx.drain()
+	}
 
-		if ctx.route != nil {
-			C.free(unsafe.Pointer(ctx.route))
-		}
+	C.eXosip_quit(ctx.context)
+	C.release(unsafe.Pointer(ctx.context))
 
-		if ctx.allow != nil {
-			C.free(unsafe.Pointer(ctx.allow))
-		}
+	if ctx.route != nil {
+		C.free(unsafe.Pointer(ctx.route))
+	}
+
+	if ctx.allow != nil {
+		C.free(unsafe.Pointer(ctx.allow))
+	}
+
+	if ctx.accept != nil {
+		C.free(unsafe.Pointer(ctx.accept))
+	}
 
-		if ctx.accept != nil {
-			C.free(unsafe.Pointer(ctx.accept))
+	if ctx.encoding != nil {
+		C.free(unsafe.Pointer(ctx.encoding))
+	}
+}
+
+// unregister without an event loop, handling only registration responses
+// until none are pending or the drain time passes
+func (ctx *Context) drain() {
+	ctx.shutdown()
+	deadline := time.Now().Add(time.Duration(ctx.Drain) * time.Second)
+	for ctx.unregistering() && time.Now().Before(deadline) {
+		evt := C.eXosip_event_wait(ctx.context, 0, 100)
+		if evt == nil {
+			ctx.Automatic()
+			continue
 		}
 
-		if ctx.encoding != nil {
-			C.free(unsafe.Pointer(ctx.encoding))
+		var event Event
+		switch C.evt_type(evt) {
+		case C.EXOSIP_REGISTRATION_SUCCESS:
+			ctx.registered(evt, &event)
+		case C.EXOSIP_REGISTRATION_FAILURE:
+			event.Status = response_status(evt.response)
+			ctx.unregistered(evt, &event)
+		default:
+			ctx.automatic_action(evt)
 		}
+		C.eXosip_event_free(evt)
+	}
+}
+
+// end subscriptions and registrations when the event loop is cancelled
+func (ctx *Context) shutdown() {
+	ctx.Lock()
+	for did := range ctx.watchers {
+		ctx.notify(did, SUB_TERMINATED, C.DEACTIVATED, "", nil)
 	}
+	ctx.Unlock()
+	ctx.Unregister()
 }
 
 func (ctx *Context) Automatic() {
@@ -182,6 +360,13 @@ func (ctx *Context) automatic_action(evt *C.eXosip_event_t) {
 }
 
 func (ctx *Context) ListenAndServe(address string, out chan<- Event) error {
+	return ctx.ListenAndServeContext(context.Background(), address, out)
+}
+
+// ListenAndServeContext runs the event loop until the parent context is
+// cancelled or the agent is closed.  On cancel it unregisters and drains
+// pending transactions for up to the configured drain time.
+func (ctx *Context) ListenAndServeContext(parent context.Context, address string, out chan<- Event) error {
 	host, port, err := net.SplitHostPort(address)
 
 	if err != nil {
@@ -202,31 +387,66 @@ func (ctx *Context) ListenAndServe(address string, out chan<- Event) error {
 	}
 
 	proto := C.int(0)
-	if ctx.Tcp {
+	if ctx.Tcp || ctx.Tls {
 		proto = 1
 	}
 
-	ctx.Port, err = strconv.Atoi(port)
+	number, err := strconv.Atoi(port)
 	if err != nil {
 		return err
 	}
-	if ctx.Port == 0 {
-		ctx.Port = int(C.find_port(ctx.context, proto, C.int(0)))
+	if number == 0 {
+		number = int(C.find_port(ctx.context, proto, boolToInt(ctx.Tls)))
 	}
 
+	ctx.Lock()
 	ctx.Host = host
+	ctx.Port = number
+	ctx.Unlock()
 	cs_host := C.CString(host)
 	defer C.free(unsafe.Pointer(cs_host))
 
-	result := int(C.sip_listen(ctx.context, cs_host, C.int(ctx.Port), family, proto, C.int(0)))
+	result := int(C.sip_listen(ctx.context, cs_host, C.int(number), family, proto, boolToInt(ctx.Tls)))
 	if result != 0 {
 		return fmt.Errorf("sip error: %d", result)
 	}
+	err = ctx.masquerade(number)
+	if err != nil {
+		return err
+	}
+
+	serve, cancel := context.WithCancel(parent)
+	defer cancel()
+	ctx.Lock()
+	if ctx.closed {
+		ctx.Unlock()
+		return fmt.Errorf("sip context closed")
+	}
+	ctx.cancel = cancel
+	ctx.done = make(chan struct{})
+	defer close(ctx.done)
+	ctx.Unlock()
 
 	var event Event = Event{Context: ctx, Type: EVT_STARTUP, Status: SIP_OK, Call: -1, Tran: -1, Dialog: -1, Expires: -1, Timestamp: time.Now()}
 	out <- event
-	for !ctx.closed {
+	var deadline time.Time
+	for {
+		if deadline.IsZero() && serve.Err() != nil {
+			deadline = time.Now().Add(time.Duration(ctx.Drain) * time.Second)
+			ctx.shutdown()
+		}
+		if !deadline.IsZero() && (ctx.inflight() < 1 || time.Now().After(deadline)) {
+			break
+		}
+
 		event = Event{Context: ctx, Type: EVT_IDLE, Status: SIP_OK, Call: -1, Tran: -1, Dialog: -1, Expires: -1, Timestamp: time.Now()}
+		if deadline.IsZero() {
+			ctx.keepalive()
+		}
+		ctx.expire()
+		for _, retry := range ctx.reregister() {
+			out <- retry
+		}
 		evt := C.eXosip_event_wait(ctx.context, C.int(ctx.Timeout/1000), C.int(ctx.Timeout%1000))
 		if evt == nil {
 			if !ctx.timeouts {
@@ -240,6 +460,10 @@ func (ctx *Context) ListenAndServe(address string, out chan<- Event) error {
 		ctx.timeouts = false
 		request := evt.request
 		response := evt.response
+		event.Call = int(evt.cid)
+		event.Dialog = int(evt.did)
+		event.Tran = int(evt.tid)
+		event.Subscription = int(evt.sid)
 		switch C.evt_type(evt) {
 		case C.EXOSIP_MESSAGE_NEW:
 			event.Type = EVT_MESSAGE
@@ -254,42 +478,246 @@ func (ctx *Context) ListenAndServe(address string, out chan<- Event) error {
 				event.Reply(status)
 				break
 			}
+			if !ctx.permitted(&event) {
+				ctx.deliver(out, &event)
+				break
+			}
+			if request.sip_method != nil && C.GoString(request.sip_method) != "OPTIONS" && ctx.throttled(&event) {
+				break
+			}
 
 			switch C.GoString(request.sip_method) {
+			case "OPTIONS":
+				ctx.options(event.Tran)
 			case "MESSAGE":
+				if !ctx.authorized(request, &event) {
+					break
+				}
+				var err error
 				event.Body, event.Content = create_body(request, 0)
-				out <- event
+				event.Parts, err = createParts(request)
+				if err != nil {
+					event.Reply(SIP_UNSUPPORTED_MEDIA)
+					break
+				}
+				ctx.deliver(out, &event)
 			default:
 				event.Type = EVT_INVALID
 				event.Reply(SIP_METHOD_NOT_ALLOWED)
 			}
-		case C.EXOSIP_REGISTRATION_SUCCESS:
-			ctx.fails = 0
-			if ctx.online {
+		case C.EXOSIP_MESSAGE_ANSWERED, C.EXOSIP_MESSAGE_REDIRECTED, C.EXOSIP_MESSAGE_REQUESTFAILURE, C.EXOSIP_MESSAGE_SERVERFAILURE, C.EXOSIP_MESSAGE_GLOBALFAILURE:
+			if request != nil && C.GoString(request.sip_method) == "OPTIONS" {
+				if ctx.pong(request, response, &event) {
+					out <- event
+				}
 				break
 			}
+			event.Type = EVT_SENT
+			event.Status = response_status(response)
+			if response == nil {
+				// transaction timeout, which also releases the message
+				event.Status = SIP_REQUEST_TIMEOUT
+			}
+			if event.Status == SIP_UNAUTHORIZED || event.Status == SIP_PROXY_AUTH_REQUIRED {
+				ctx.automatic_action(evt)
+				break
+			}
+			event.Tran = ctx.sentTran(request, event.Tran)
+			if request != nil {
+				event.headers(request)
+			}
+			out <- event
+		case C.EXOSIP_IN_SUBSCRIPTION_NEW:
+			event.Type = EVT_SUBSCRIBE
+			event.Status = SIP_OK
+			if request == nil {
+				event.Reply(SIP_BAD_REQUEST)
+				break
+			}
+
+			status := event.headers(request)
+			if status != SIP_OK {
+				event.Reply(status)
+				break
+			}
+			event.Package = headerString(request, "event")
+			if len(event.Package) < 1 {
+				event.Reply(SIP_BAD_EVENT)
+				break
+			}
+			if !ctx.permitted(&event) {
+				ctx.deliver(out, &event)
+				break
+			}
+			if ctx.throttled(&event) {
+				break
+			}
+			if !ctx.authorized(request, &event) {
+				break
+			}
+			if ctx.subscription(&event) {
+				ctx.deliver(out, &event)
+			}
+		case C.EXOSIP_NOTIFICATION_NOANSWER, C.EXOSIP_NOTIFICATION_ANSWERED, C.EXOSIP_NOTIFICATION_REDIRECTED, C.EXOSIP_NOTIFICATION_REQUESTFAILURE, C.EXOSIP_NOTIFICATION_SERVERFAILURE, C.EXOSIP_NOTIFICATION_GLOBALFAILURE:
+			ctx.notified(evt, response_status(response))
+		case C.EXOSIP_SUBSCRIPTION_NOANSWER, C.EXOSIP_SUBSCRIPTION_ANSWERED, C.EXOSIP_SUBSCRIPTION_REDIRECTED, C.EXOSIP_SUBSCRIPTION_REQUESTFAILURE, C.EXOSIP_SUBSCRIPTION_SERVERFAILURE, C.EXOSIP_SUBSCRIPTION_GLOBALFAILURE:
+			event.Type = EVT_SUBSCRIBED
+			event.Status = response_status(response)
+			if response == nil {
+				event.Status = SIP_REQUEST_TIMEOUT
+			}
+			if request != nil {
+				event.headers(request)
+				event.Package = headerString(request, "event")
+			}
+			if ctx.subscribed(evt, &event) {
+				out <- event
+			}
+		case C.EXOSIP_SUBSCRIPTION_NOTIFY:
+			event.Type = EVT_NOTIFY
+			event.Status = SIP_OK
+			if request == nil {
+				break
+			}
+			event.headers(request)
+			event.Package = headerString(request, "event")
+			event.Body, event.Content = create_body(request, 0)
+			event.Parts, _ = createParts(request)
+			ctx.notification(&event, headerString(request, "subscription-state"))
+			ctx.deliver(out, &event)
+		case C.EXOSIP_REGISTRATION_SUCCESS:
 			event.Type = EVT_REGISTER
 			event.Status = SIP_OK
-			if ctx.active != -1 {
-				ctx.online = true
-				event.Body, event.Content = create_body(response, 0)
-			} else {
-				ctx.online = false
+			if ctx.registered(evt, &event) {
+				out <- event
 			}
-			out <- event
 		case C.EXOSIP_REGISTRATION_FAILURE:
 			event.Type = EVT_REGISTER
-			ctx.fails = ctx.fails + 1
+			event.Status = response_status(response)
+			if ctx.unregistered(evt, &event) {
+				out <- event
+			}
+		case C.EXOSIP_CALL_INVITE, C.EXOSIP_CALL_REINVITE:
+			event.Type = EVT_CALL_INVITE
+			if C.evt_type(evt) == C.EXOSIP_CALL_REINVITE {
+				event.Type = EVT_CALL_REINVITE
+			}
+			event.Status = SIP_OK
+			if request == nil {
+				event.Reply(SIP_BAD_REQUEST)
+				break
+			}
+
+			status := event.headers(request)
+			if status != SIP_OK {
+				event.Reply(status)
+				break
+			}
+			if event.Type == EVT_CALL_INVITE {
+				if !ctx.permitted(&event) {
+					ctx.deliver(out, &event)
+					break
+				}
+				if ctx.throttled(&event) || !ctx.authorized(request, &event) {
+					break
+				}
+			}
+			event.Body, event.Content = create_body(request, 0)
+			ctx.deliver(out, &event)
+		case C.EXOSIP_CALL_ACK:
+			event.Type = EVT_CALL_ACK
+			event.Status = SIP_OK
+			event.Body, event.Content = create_body(evt.ack, 0)
+			out <- event
+		case C.EXOSIP_CALL_RINGING:
+			event.Type = EVT_CALL_RINGING
+			event.Status = response_status(response)
+			out <- event
+		case C.EXOSIP_CALL_ANSWERED:
+			event.Type = EVT_CALL_ANSWERED
+			event.Status = response_status(response)
+			event.Body, event.Content = create_body(response, 0)
+			ctx.Lock()
+			C.call_ack(ctx.context, evt.did)
+			ctx.Unlock()
+			out <- event
+		case C.EXOSIP_CALL_NOANSWER, C.EXOSIP_CALL_REQUESTFAILURE, C.EXOSIP_CALL_SERVERFAILURE, C.EXOSIP_CALL_GLOBALFAILURE:
+			event.Type = EVT_CALL_FAILED
+			event.Status = response_status(response)
+			if response == nil {
+				event.Status = SIP_REQUEST_TIMEOUT
+			}
+			if event.Status == SIP_UNAUTHORIZED || event.Status == SIP_PROXY_AUTH_REQUIRED {
+				ctx.automatic_action(evt)
+				break
+			}
+			out <- event
+		case C.EXOSIP_CALL_MESSAGE_NEW:
+			switch method(request) {
+			case "INFO":
+				event.Type = EVT_DTMF
+			case "REFER":
+				event.Type = EVT_REFER
+			case "NOTIFY":
+				event.Type = EVT_TRANSFER
+			default:
+				ctx.automatic_action(evt)
+			}
+			if event.Type == EVT_IDLE {
+				break
+			}
+
+			event.Status = SIP_OK
+			status := event.headers(request)
+			if status != SIP_OK {
+				event.Reply(status)
+				break
+			}
+			event.Body, event.Content = create_body(request, 0)
+			switch event.Type {
+			case EVT_DTMF:
+				if ctx.dtmf(&event) {
+					ctx.deliver(out, &event)
+				}
+			case EVT_REFER:
+				if ctx.referred(&event) {
+					ctx.deliver(out, &event)
+				}
+			default:
+				if ctx.progress(&event) {
+					out <- event
+				}
+			}
+		case C.EXOSIP_CALL_MESSAGE_ANSWERED, C.EXOSIP_CALL_MESSAGE_REDIRECTED, C.EXOSIP_CALL_MESSAGE_REQUESTFAILURE, C.EXOSIP_CALL_MESSAGE_SERVERFAILURE, C.EXOSIP_CALL_MESSAGE_GLOBALFAILURE:
+			event.Status = response_status(response)
 			if response == nil {
-				event.Status = SIP_UNKNOWN
-			} else {
-				event.Status = SIP_STATUS(response.status_code)
+				event.Status = SIP_REQUEST_TIMEOUT
 			}
-			if ctx.fails < 2 && ctx.active != -1 && (event.Status == SIP_UNAUTHORIZED || event.Status == SIP_PROXY_AUTH_REQUIRED) {
+			if method(request) != "REFER" || event.Status == SIP_UNAUTHORIZED || event.Status == SIP_PROXY_AUTH_REQUIRED {
 				ctx.automatic_action(evt)
 				break
 			}
-			ctx.online = false
+			event.Type = EVT_TRANSFER
+			event.Method = "REFER"
+			out <- event
+		case C.EXOSIP_CALL_REDIRECTED:
+			event.Type = EVT_CALL_REDIRECTED
+			event.Status = response_status(response)
+			if response != nil {
+				event.headers(response)
+			}
+			out <- event
+		case C.EXOSIP_CALL_CANCELLED:
+			event.Type = EVT_CALL_CANCELLED
+			event.Status = SIP_REQUEST_TERMINATED
+			out <- event
+		case C.EXOSIP_CALL_CLOSED:
+			event.Type = EVT_CALL_CLOSED
+			event.Status = SIP_OK
+			out <- event
+		case C.EXOSIP_CALL_RELEASED:
+			event.Type = EVT_CALL_RELEASED
+			event.Status = SIP_OK
 			out <- event
 		default:
 			ctx.automatic_action(evt)
@@ -299,16 +727,47 @@ func (ctx *Context) ListenAndServe(address string, out chan<- Event) error {
 
 	event = Event{Context: nil, Type: EVT_SHUTDOWN, Status: SIP_OK, Call: -1, Tran: -1, Dialog: -1, Expires: -1, Timestamp: time.Now()}
 	out <- event
-	ctx.active = -1
-	ctx.online = false
-	return nil
+	if count := ctx.inflight(); count > 0 {
+		err = fmt.Errorf("shutdown drain timed out; pending=%d", count)
+	}
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.cancel = nil
+	ctx.pending = make(map[int]*registration)
+	ctx.messages = make(map[string]int)
+	ctx.pings = make(map[string]time.Time)
+	ctx.watchers = make(map[int]*watcher)
+	ctx.subscriptions = make(map[int]int)
+	ctx.cancelled = make(map[int]bool)
+	ctx.probed = false
+	ctx.reachable = false
+	for _, reg := range ctx.registry {
+		reg.online = false
+	}
+	return err
 }
 
 // sip := osip.New(...)
 func New(config Config) *Context {
-	ctx := &Context{Config: config, context: C.eXosip_malloc(), Tls: false, closed: false, active: -1}
+	ctx := &Context{Config: config, context: C.eXosip_malloc(), Tls: false, closed: false, messages: make(map[string]int), pings: make(map[string]time.Time), nonces: make(map[string]*nonceState), watchers: make(map[int]*watcher), subscriptions: make(map[int]int), cancelled: make(map[int]bool), registry: make(map[string]*registration), pending: make(map[int]*registration)}
 	C.eXosip_init(ctx.context)
 	C.set_option(ctx.context, C.EXOSIP_OPT_ENABLE_IPV6, boolToInt(config.Ipv6))
+	C.set_option(ctx.context, C.EXOSIP_OPT_USE_RPORT, boolToInt(config.Rport))
+	if config.NatKeepalive > 0 {
+		C.set_option(ctx.context, C.EXOSIP_OPT_UDP_KEEP_ALIVE, C.int(config.NatKeepalive*1000))
+	}
+
+	if len(ctx.Certificate) > 0 || strings.HasPrefix(ctx.Server, "sips:") {
+		ctx.Tls = true
+		cs_cert := C.CString(ctx.Certificate)
+		cs_key := C.CString(ctx.PrivateKey)
+		cs_ca := C.CString(ctx.Authority)
+		defer C.free(unsafe.Pointer(cs_cert))
+		defer C.free(unsafe.Pointer(cs_key))
+		defer C.free(unsafe.Pointer(cs_ca))
+		C.set_tls(ctx.context, cs_cert, cs_key, cs_ca, boolToInt(ctx.Verify))
+	}
 
 	if len(ctx.Server) > 0 {
 		ctx.route = C.CString(ctx.Server)
@@ -333,6 +792,14 @@ func New(config Config) *Context {
 		ctx.Timeout = 500
 	}
 
+	if ctx.Backoff == 0 {
+		ctx.Backoff = 300
+	}
+
+	if ctx.Drain == 0 {
+		ctx.Drain = 5
+	}
+
 	if len(config.Agent) > 0 {
 		cs_agent := C.CString(config.Agent)
 		defer C.free(unsafe.Pointer(cs_agent))
@@ -372,35 +839,71 @@ func create_body(msg *C.osip_message_t, index int) ([]byte, string) {
 	return data, C.GoString(content.ctype) + "/" + C.GoString(content.subtype)
 }
 
-func (event *Event) Reply(status SIP_STATUS) {
+func method(msg *C.osip_message_t) string {
+	if msg == nil || msg.sip_method == nil {
+		return ""
+	}
+	return C.GoString(msg.sip_method)
+}
+
+func response_status(msg *C.osip_message_t) SIP_STATUS {
+	if msg == nil {
+		return SIP_UNKNOWN
+	}
+	return SIP_STATUS(msg.status_code)
+}
+
+// Reply to a received request event
+func (ctx *Context) Reply(event *Event, status SIP_STATUS) {
 	event.Status = status
-	event.sendReply(nil)
+	ctx.sendReply(event, nil)
+	if event.Type == EVT_SUBSCRIBE && status < 300 {
+		ctx.watch(event)
+	}
 }
 
-func (event *Event) makeReply() *C.osip_message_t {
-	ctx := event.Context
+func (ctx *Context) makeReply(event *Event) *C.osip_message_t {
 	tid := C.int(event.Tran)
 	status := C.int(event.Status)
 	switch event.Type {
 	case EVT_MESSAGE:
 		return C.message_response(ctx.context, tid, status)
+	case EVT_CALL_INVITE, EVT_CALL_REINVITE, EVT_DTMF, EVT_REFER, EVT_TRANSFER:
+		return C.call_response(ctx.context, tid, status)
+	case EVT_SUBSCRIBE:
+		return C.subscribe_response(ctx.context, tid, status)
 	}
 	return nil
 }
 
-func (event *Event) sendReply(msg *C.osip_message_t) {
-	ctx := event.Context
+func (ctx *Context) sendReply(event *Event, msg *C.osip_message_t) {
 	switch event.Type {
 	case EVT_MESSAGE, EVT_INVALID:
 		ctx.Lock()
 		defer ctx.Unlock()
 		C.eXosip_message_send_answer(ctx.context, C.int(event.Tran), C.int(event.Status), msg)
+	case EVT_CALL_INVITE, EVT_CALL_REINVITE, EVT_DTMF, EVT_REFER, EVT_TRANSFER:
+		ctx.Lock()
+		defer ctx.Unlock()
+		C.eXosip_call_send_answer(ctx.context, C.int(event.Tran), C.int(event.Status), msg)
+	case EVT_SUBSCRIBE:
+		ctx.Lock()
+		defer ctx.Unlock()
+		C.eXosip_insubscription_send_answer(ctx.context, C.int(event.Tran), C.int(event.Status), msg)
 	default:
 		return
 	}
 }
 
+// answer inbound options with our capabilities
+func (ctx *Context) options(tid int) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	C.options_answer(ctx.context, C.int(tid), ctx.allow, ctx.accept, ctx.encoding)
+}
+
 func (event *Event) headers(msg *C.osip_message_t) SIP_STATUS {
+	event.collect(msg)
 	from := msg.from
 	if from == nil || from.url == nil {
 		return SIP_ADDRESS_INCOMPLETE
@@ -13,6 +13,7 @@
 // You should have received a copy of the GNU General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
+#include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
 #include <stdbool.h>
@@ -33,6 +34,23 @@ void set_option(struct eXosip_t *ctx, int option, int value) {
 	eXosip_set_option(ctx, option, &value);
 }
 
+void set_tls(struct eXosip_t *ctx, const char *cert, const char *key, const char *ca, int verify) {
+    eXosip_tls_ctx_t tls;
+    memset(&tls, 0, sizeof(tls));
+    if(ca)
+        snprintf(tls.root_ca_cert, sizeof(tls.root_ca_cert), "%s", ca);
+    if(cert) {
+        snprintf(tls.server.cert, sizeof(tls.server.cert), "%s", cert);
+        snprintf(tls.client.cert, sizeof(tls.client.cert), "%s", cert);
+    }
+    if(key) {
+        snprintf(tls.server.priv_key, sizeof(tls.server.priv_key), "%s", key);
+        snprintf(tls.client.priv_key, sizeof(tls.client.priv_key), "%s", key);
+    }
+    eXosip_set_option(ctx, EXOSIP_OPT_SET_TLS_CERTIFICATES_INFO, &tls);
+    eXosip_set_option(ctx, EXOSIP_OPT_SET_TLS_VERIFY_CERTIFICATE, &verify);
+}
+
 char *get_url(osip_uri_t *uri) {
     char *str = NULL;
     osip_uri_to_str(uri, &str);
@@ -55,6 +73,22 @@ int get_expires(osip_message_t *msg, int index) {
     return -1;
 }
 
+char *get_header(osip_message_t *msg, const char *name) {
+    osip_header_t *header = NULL;
+    osip_message_header_get_byname(msg, name, 0, &header);
+    if(header && header->hvalue)
+        return header->hvalue;
+    return NULL;
+}
+
+int get_header_int(osip_message_t *msg, const char *name) {
+    osip_header_t *header = NULL;
+    osip_message_header_get_byname(msg, name, 0, &header);
+    if(header && header->hvalue)
+        return atoi(header->hvalue);
+    return -1;
+}
+
 osip_message_t *message_response(struct eXosip_t *ctx, int tid, int status) {
     osip_message_t *msg = NULL;
     eXosip_message_build_answer(ctx, tid, status, &msg);
@@ -67,6 +101,34 @@ osip_message_t *call_response(struct eXosip_t *ctx, int tid, int status) {
     return msg;
 }
 
+osip_message_t *subscribe_response(struct eXosip_t *ctx, int tid, int status) {
+    osip_message_t *msg = NULL;
+    eXosip_insubscription_build_answer(ctx, tid, status, &msg);
+    return msg;
+}
+
+int call_ack(struct eXosip_t *ctx, int did) {
+    osip_message_t *msg = NULL;
+    int res = eXosip_call_build_ack(ctx, did, &msg);
+    if(res)
+        return res;
+    return eXosip_call_send_ack(ctx, did, msg);
+}
+
+int options_answer(struct eXosip_t *ctx, int tid, const char *allow, const char *accept, const char *encoding) {
+    osip_message_t *msg = NULL;
+    int res = eXosip_options_build_answer(ctx, tid, 200, &msg);
+    if(res)
+        return res;
+    if(allow)
+        osip_message_set_header(msg, ALLOW, allow);
+    if(accept)
+        osip_message_set_header(msg, ACCEPT, accept);
+    if(encoding)
+        osip_message_set_header(msg, ACCEPT_ENCODING, encoding);
+    return eXosip_options_send_answer(ctx, tid, 200, msg);
+}
+
 content_type_t get_content(osip_message_t *msg) {
     content_type_t res = {NULL, NULL};
     osip_content_type_t *ctype = osip_message_get_content_type(msg);
@@ -0,0 +1,84 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// reply 503 with retry-after to a request
+func (ctx *Context) busy(event *Event, retry time.Duration) {
+	seconds := int((retry + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	cs_retry := C.CString(strconv.Itoa(seconds))
+	defer C.free(unsafe.Pointer(cs_retry))
+
+	event.Status = SIP_SERVICE_UNAVAILABLE
+	ctx.Lock()
+	msg := ctx.makeReply(event)
+	if msg != nil {
+		C.osip_message_set_retry_after(msg, cs_retry)
+	}
+	ctx.Unlock()
+	ctx.sendReply(event, msg)
+}
+
+// check rate limits for a new request, replying 503 if exceeded
+func (ctx *Context) throttled(event *Event) bool {
+	ctx.Lock()
+	ok, retry := ctx.limits.allow(&ctx.Config, event.Source, time.Now())
+	if !ok {
+		ctx.limited++
+	}
+	ctx.Unlock()
+	if ok {
+		return false
+	}
+	ctx.busy(event, retry)
+	return true
+}
+
+// deliver an inbound request event using the overflow policy, so a full
+// event channel does not stall the sip stack.
+func (ctx *Context) deliver(out chan<- Event, event *Event) {
+	if ctx.Overflow == OVERFLOW_BLOCK {
+		out <- *event
+		return
+	}
+
+	select {
+	case out <- *event:
+		return
+	default:
+	}
+
+	ctx.Lock()
+	ctx.overflows++
+	ctx.Unlock()
+	if ctx.Overflow == OVERFLOW_REJECT && event.Type != EVT_INVALID && event.Type != EVT_NOTIFY {
+		ctx.busy(event, time.Second)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+
+static void free_string(char *str) {
+    if(osip_free_func)
+        osip_free_func(str);
+    else
+        free(str);
+}
+*/
+import "C"
+import (
+	"strings"
+	"unsafe"
+)
+
+// take ownership of an osip allocated string
+func takeString(str *C.char) string {
+	if str == nil {
+		return ""
+	}
+	defer C.free_string(str)
+	return C.GoString(str)
+}
+
+// serialize a parsed osip header element
+type toString func(element unsafe.Pointer, dest **C.char) C.int
+
+func fromString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_from_to_str((*C.osip_from_t)(element), dest)
+}
+
+func viaString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_via_to_str((*C.osip_via_t)(element), dest)
+}
+
+func typeString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_content_type_to_str((*C.osip_content_type_t)(element), dest)
+}
+
+func lengthString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_content_length_to_str((*C.osip_content_length_t)(element), dest)
+}
+
+func encodingString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_accept_encoding_to_str((*C.osip_accept_encoding_t)(element), dest)
+}
+
+func infoString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_call_info_to_str((*C.osip_call_info_t)(element), dest)
+}
+
+func authorizationString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_authorization_to_str((*C.osip_authorization_t)(element), dest)
+}
+
+func authenticateString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_www_authenticate_to_str((*C.osip_www_authenticate_t)(element), dest)
+}
+
+func authInfoString(element unsafe.Pointer, dest **C.char) C.int {
+	return C.osip_authentication_info_to_str((*C.osip_authentication_info_t)(element), dest)
+}
+
+// collect request line and headers of a sip message
+func (event *Event) collect(msg *C.osip_message_t) {
+	headers := make(map[string][]string)
+	add := func(name, value string) {
+		if len(value) > 0 {
+			name = strings.ToLower(name)
+			headers[name] = append(headers[name], value)
+		}
+	}
+
+	if msg.sip_method != nil {
+		event.Method = C.GoString(msg.sip_method)
+	}
+	if msg.req_uri != nil {
+		var uri *C.char
+		C.osip_uri_to_str(msg.req_uri, &uri)
+		event.Uri = takeString(uri)
+	}
+
+	if msg.call_id != nil {
+		var id *C.char
+		C.osip_call_id_to_str(msg.call_id, &id)
+		add("call-id", takeString(id))
+	}
+	if msg.cseq != nil && msg.cseq.number != nil && msg.cseq.method != nil {
+		add("cseq", C.GoString(msg.cseq.number)+" "+C.GoString(msg.cseq.method))
+	}
+
+	format := func(name string, element unsafe.Pointer, str toString) {
+		var dest *C.char
+		if element != nil && str(element, &dest) == 0 {
+			add(name, takeString(dest))
+		}
+	}
+	format("from", unsafe.Pointer(msg.from), fromString)
+	format("to", unsafe.Pointer(msg.to), fromString)
+	format("content-type", unsafe.Pointer(msg.content_type), typeString)
+	format("content-length", unsafe.Pointer(msg.content_length), lengthString)
+	format("mime-version", unsafe.Pointer(msg.mime_version), lengthString)
+
+	// headers osip parses into lists, one entry per element
+	lists := []struct {
+		name string
+		list *C.osip_list_t
+		str  toString
+	}{
+		{"via", &msg.vias, viaString},
+		{"route", &msg.routes, fromString},
+		{"record-route", &msg.record_routes, fromString},
+		{"contact", &msg.contacts, fromString},
+		{"allow", &msg.allows, lengthString},
+		{"accept", &msg.accepts, typeString},
+		{"accept-encoding", &msg.accept_encodings, encodingString},
+		{"accept-language", &msg.accept_languages, encodingString},
+		{"alert-info", &msg.alert_infos, infoString},
+		{"call-info", &msg.call_infos, infoString},
+		{"error-info", &msg.error_infos, infoString},
+		{"authorization", &msg.authorizations, authorizationString},
+		{"proxy-authorization", &msg.proxy_authorizations, authorizationString},
+		{"www-authenticate", &msg.www_authenticates, authenticateString},
+		{"proxy-authenticate", &msg.proxy_authenticates, authenticateString},
+		{"authentication-info", &msg.authentication_infos, authInfoString},
+		{"proxy-authentication-info", &msg.proxy_authentication_infos, authInfoString},
+	}
+	for _, entry := range lists {
+		for pos := 0; pos < int(C.osip_list_size(entry.list)); pos++ {
+			format(entry.name, C.osip_list_get(entry.list, C.int(pos)), entry.str)
+		}
+	}
+
+	for pos := 0; ; pos++ {
+		var header *C.osip_header_t
+		if C.osip_message_get_content_encoding(msg, C.int(pos), &header) < 0 || header == nil {
+			break
+		}
+		if header.hvalue != nil {
+			add("content-encoding", C.GoString(header.hvalue))
+		}
+	}
+
+	// everything osip does not parse, such as user-agent, priority, x-
+	for pos := 0; ; pos++ {
+		var header *C.osip_header_t
+		if C.osip_message_get_header(msg, C.int(pos), &header) < 0 || header == nil {
+			break
+		}
+		if header.hname != nil && header.hvalue != nil {
+			add(C.GoString(header.hname), C.GoString(header.hvalue))
+		}
+	}
+	event.Headers = headers
+	event.Source = source(msg)
+}
+
+// source address a client reports in the top via, or received if osip
+// appended one.  A client can forge either, so this is informational and
+// not used for access control.
+func source(msg *C.osip_message_t) string {
+	var via *C.osip_via_t
+	if C.osip_message_get_via(msg, 0, &via) < 0 || via == nil {
+		return ""
+	}
+
+	cs_received := C.CString("received")
+	defer C.free(unsafe.Pointer(cs_received))
+	var param *C.osip_generic_param_t
+	if C.osip_via_param_get_byname(via, cs_received, &param) > -1 && param != nil && param.gvalue != nil {
+		return C.GoString(param.gvalue)
+	}
+	if via.host == nil {
+		return ""
+	}
+	return C.GoString(via.host)
+}
+
+// content type of a message or body with parameters
+func contentType(ctype *C.osip_content_type_t) string {
+	if ctype == nil {
+		return ""
+	}
+	var str *C.char
+	C.osip_content_type_to_str(ctype, &str)
+	return takeString(str)
+}
+
+// decode all body parts of a sip message
+func createParts(msg *C.osip_message_t) ([]Part, error) {
+	if msg == nil {
+		return nil, nil
+	}
+
+	encoding := ""
+	var header *C.osip_header_t
+	if C.osip_message_get_content_encoding(msg, 0, &header) > -1 && header != nil && header.hvalue != nil {
+		encoding = C.GoString(header.hvalue)
+	}
+
+	// a multipart with one part is also split by osip, and then the
+	// body has the content type of the part rather than the message
+	content := contentType(msg.content_type)
+	count := int(C.osip_list_size(&msg.bodies))
+	if count < 2 && !strings.HasPrefix(strings.ToLower(content), "multipart/") {
+		body, _ := create_body(msg, 0)
+		return decodeParts(content, encoding, body)
+	}
+
+	// multipart already split by osip, parts share the decoded limit
+	var parts []Part
+	remaining := maxDecoded
+	for pos := 0; pos < count; pos++ {
+		var body *C.osip_body_t
+		if C.osip_message_get_body(msg, C.int(pos), &body) < 0 || body == nil || body.body == nil {
+			continue
+		}
+		data := C.GoBytes(unsafe.Pointer(body.body), C.int(body.length))
+		list, err := decodeNested(contentType(body.content_type), "", data, 1, &remaining)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, list...)
+	}
+	return parts, nil
+}
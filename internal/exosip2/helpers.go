@@ -12,6 +12,7 @@
 //
 // You should have received a copy of the GNU General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
 
 package exosip2
 
@@ -20,7 +21,14 @@ package exosip2
 #include <string.h>
 */
 import "C"
-import "unsafe"
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
 
 func (ctx *Context) GetSchema() string {
 	if ctx.Tls {
@@ -29,27 +37,49 @@ func (ctx *Context) GetSchema() string {
 	return "sip:"
 }
 
-func (ctx *Context) GetIdentity() string {
+func (ctx *Context) GetAddress() string {
 	ctx.Lock()
 	defer ctx.Unlock()
+	return net.JoinHostPort(ctx.Host, strconv.Itoa(ctx.Port))
+}
 
-	if ctx.active == -1 {
-		return ""
+// GetIdentity of the primary registration
+func (ctx *Context) GetIdentity() string {
+	ctx.Lock()
+	if _, ok := ctx.registry[ctx.identity]; ok {
+		defer ctx.Unlock()
+		return ctx.identity
 	}
+	ctx.Unlock()
 
-	return ctx.identity
+	list := ctx.GetIdentities()
+	if len(list) < 1 {
+		return ""
+	}
+	return list[0]
 }
 
 func (ctx *Context) IsOpen() bool {
+	ctx.Lock()
+	defer ctx.Unlock()
 	return !ctx.closed
 }
 
 func (ctx *Context) IsActive() bool {
-	return ctx.active != -1
+	ctx.Lock()
+	defer ctx.Unlock()
+	return len(ctx.registry) > 0
 }
 
 func (ctx *Context) IsOnline() bool {
-	return ctx.online
+	ctx.Lock()
+	defer ctx.Unlock()
+	for _, reg := range ctx.registry {
+		if reg.online {
+			return true
+		}
+	}
+	return false
 }
 
 func (ctx *Context) SetRoute(route string) bool {
@@ -78,3 +108,114 @@ func (ctx *Context) SetRoute(route string) bool {
 	}
 	return true
 }
+
+// SetACL replaces access rules for inbound requests, nil allows all
+func (ctx *Context) SetACL(acl *ACL) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.acl = acl
+}
+
+// check access of a new request, replying 403 and changing the event to
+// an EVT_INVALID audit event if denied.
+func (ctx *Context) permitted(event *Event) bool {
+	ctx.Lock()
+	acl := ctx.acl
+	ctx.Unlock()
+	if acl.Permit(event.From) {
+		return true
+	}
+	event.Reply(SIP_FORBIDDEN)
+	event.Type = EVT_INVALID
+	return false
+}
+
+// loose route for out of dialog requests, caller must hold lock and free
+func (ctx *Context) looseRoute() *C.char {
+	if ctx.route == nil {
+		return nil
+	}
+
+	route := C.GoString(ctx.route)
+	if !strings.Contains(route, ";lr") {
+		route += ";lr"
+	}
+	return C.CString(route)
+}
+
+// find registration by rid, and if it is being removed
+func (ctx *Context) findRegistration(rid int) (*registration, bool) {
+	for _, reg := range ctx.registry {
+		if reg.rid == rid {
+			return reg, false
+		}
+	}
+	if reg, ok := ctx.pending[rid]; ok {
+		return reg, true
+	}
+	return nil, false
+}
+
+// if unregistrations are awaiting a response
+func (ctx *Context) unregistering() bool {
+	ctx.Lock()
+	defer ctx.Unlock()
+	return len(ctx.pending) > 0
+}
+
+// count of unregistrations and messages awaiting a response
+func (ctx *Context) inflight() int {
+	ctx.Lock()
+	defer ctx.Unlock()
+	return len(ctx.pending) + len(ctx.messages)
+}
+
+// GetIdentities of all active registrations
+func (ctx *Context) GetIdentities() []string {
+	ctx.Lock()
+	defer ctx.Unlock()
+	list := make([]string, 0, len(ctx.registry))
+	for identity := range ctx.registry {
+		list = append(list, identity)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// IsRegistered if an identity is registered and online
+func (ctx *Context) IsRegistered(identity string) bool {
+	ctx.Lock()
+	defer ctx.Unlock()
+	reg, ok := ctx.registry[identity]
+	return ok && reg.online
+}
+
+// Snapshot copies current context state under lock
+func (ctx *Context) Snapshot() Snapshot {
+	ctx.Lock()
+	defer ctx.Unlock()
+	snap := Snapshot{
+		Open:          !ctx.closed,
+		Address:       net.JoinHostPort(ctx.Host, strconv.Itoa(ctx.Port)),
+		Public:        ctx.public,
+		Identity:      ctx.identity,
+		Reachable:     ctx.reachable,
+		Latency:       ctx.latency,
+		Pending:       len(ctx.pending) + len(ctx.messages),
+		Watchers:      len(ctx.watchers),
+		Subscriptions: len(ctx.subscriptions),
+		Limited:       ctx.limited,
+		Overflows:     ctx.overflows,
+		Timestamp:     time.Now(),
+	}
+	if ctx.route != nil {
+		snap.Route = C.GoString(ctx.route)
+	}
+	for _, reg := range ctx.registry {
+		snap.Registrations = append(snap.Registrations, reg.snapshot())
+	}
+	sort.Slice(snap.Registrations, func(i, j int) bool {
+		return snap.Registrations[i].Identity < snap.Registrations[j].Identity
+	})
+	return snap
+}
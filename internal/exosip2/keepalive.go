@@ -0,0 +1,104 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// IsReachable is true if the server route answered the last options ping
+func (ctx *Context) IsReachable() bool {
+	ctx.Lock()
+	defer ctx.Unlock()
+	return ctx.reachable
+}
+
+// GetLatency is the round trip of the last answered options ping
+func (ctx *Context) GetLatency() time.Duration {
+	ctx.Lock()
+	defer ctx.Unlock()
+	return ctx.latency
+}
+
+// ping the server route with options if the keepalive interval expired
+func (ctx *Context) keepalive() {
+	if ctx.Keepalive < 1 || len(ctx.Server) < 1 || time.Since(ctx.pinged) < time.Duration(ctx.Keepalive)*time.Second {
+		return
+	}
+
+	ctx.pinged = time.Now()
+	from := ctx.GetIdentity()
+	if len(from) < 1 {
+		host := strings.TrimPrefix(strings.TrimPrefix(ctx.Server, "sips:"), "sip:")
+		from = ctx.GetSchema() + "keepalive@" + host
+	}
+
+	cs_from := C.CString(from)
+	defer C.free(unsafe.Pointer(cs_from))
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	var msg *C.osip_message_t
+	result := int(C.eXosip_options_build_request(ctx.context, &msg, ctx.route, cs_from, nil))
+	if result != 0 {
+		return
+	}
+	id := callId(msg)
+	if C.eXosip_options_send_request(ctx.context, msg) < 0 {
+		return
+	}
+	ctx.pings[id] = ctx.pinged
+}
+
+// options ping response, returns true if peer state changed
+func (ctx *Context) pong(request, response *C.osip_message_t, event *Event) bool {
+	id := callId(request)
+	ctx.Lock()
+	defer ctx.Unlock()
+	sent, ok := ctx.pings[id]
+	if !ok {
+		return false
+	}
+
+	// any response, even a challenge, means the peer is alive
+	delete(ctx.pings, id)
+	event.Status = response_status(response)
+	reachable := response != nil && event.Status != SIP_REQUEST_TIMEOUT
+	if response == nil {
+		event.Status = SIP_REQUEST_TIMEOUT
+	}
+	if reachable {
+		ctx.latency = time.Since(sent)
+		event.Latency = ctx.latency
+		event.Type = EVT_PEER_UP
+	} else {
+		event.Type = EVT_PEER_DOWN
+	}
+	if ctx.probed && reachable == ctx.reachable {
+		return false
+	}
+	ctx.probed = true
+	ctx.reachable = reachable
+	return true
+}
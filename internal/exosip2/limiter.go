@@ -0,0 +1,135 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// what to do with inbound requests when the event channel is full
+type OVERFLOW int
+
+const (
+	OVERFLOW_BLOCK OVERFLOW = iota
+	OVERFLOW_DROP
+	OVERFLOW_REJECT
+)
+
+// ParseOverflow converts a block, drop, or reject policy name
+func ParseOverflow(policy string) (OVERFLOW, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", "block":
+		return OVERFLOW_BLOCK, nil
+	case "drop":
+		return OVERFLOW_DROP, nil
+	case "reject":
+		return OVERFLOW_REJECT, nil
+	}
+	return OVERFLOW_BLOCK, fmt.Errorf("invalid overflow policy %s", policy)
+}
+
+// idle time before a source bucket is forgotten, and most sources kept
+const (
+	sourceIdle = time.Minute
+	maxSources = 4096
+)
+
+// token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(rate float64, burst int, now time.Time) (bool, time.Duration) {
+	if burst < 1 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// global and per source request limits.  Sources are the address a request
+// reports, which a client can forge to avoid it's own limit, so only the
+// global limit bounds a hostile flood.
+type limiter struct {
+	global  bucket
+	sources map[string]*bucket
+	pruned  time.Time
+}
+
+// forget the least recently seen source to make room for a new one
+func (limit *limiter) evict() {
+	var oldest string
+	var last time.Time
+	for key, b := range limit.sources {
+		if last.IsZero() || b.last.Before(last) {
+			oldest, last = key, b.last
+		}
+	}
+	delete(limit.sources, oldest)
+}
+
+// check limits for a request transport address, with time until a retry may pass
+func (limit *limiter) allow(config *Config, source string, now time.Time) (bool, time.Duration) {
+	if config.SourceRate > 0 {
+		if limit.sources == nil {
+			limit.sources = make(map[string]*bucket)
+		}
+		if now.Sub(limit.pruned) > sourceIdle {
+			limit.pruned = now
+			for key, idle := range limit.sources {
+				if now.Sub(idle.last) > sourceIdle {
+					delete(limit.sources, key)
+				}
+			}
+		}
+
+		b, ok := limit.sources[source]
+		if !ok {
+			if len(limit.sources) >= maxSources {
+				limit.evict()
+			}
+			b = &bucket{}
+			limit.sources[source] = b
+		}
+		if ok, retry := b.take(config.SourceRate, config.SourceBurst, now); !ok {
+			return false, retry
+		}
+	}
+
+	if config.Rate > 0 {
+		return limit.global.take(config.Rate, config.Burst, now)
+	}
+	return true, 0
+}
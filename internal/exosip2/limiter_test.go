@@ -0,0 +1,102 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseOverflow(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   OVERFLOW
+		fails  bool
+	}{
+		{"", OVERFLOW_BLOCK, false},
+		{"block", OVERFLOW_BLOCK, false},
+		{" Drop ", OVERFLOW_DROP, false},
+		{"reject", OVERFLOW_REJECT, false},
+		{"discard", OVERFLOW_BLOCK, true},
+	}
+	for _, test := range tests {
+		got, err := ParseOverflow(test.policy)
+		if got != test.want || (err != nil) != test.fails {
+			t.Errorf("%q: got %v %v, want %v", test.policy, got, err, test.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name   string
+		config Config
+		source string
+		offset time.Duration
+		want   bool
+	}{
+		{"first of burst", Config{Rate: 1, Burst: 2}, "a", 0, true},
+		{"second of burst", Config{Rate: 1, Burst: 2}, "a", 0, true},
+		{"burst exhausted", Config{Rate: 1, Burst: 2}, "a", 0, false},
+		{"refilled", Config{Rate: 1, Burst: 2}, "a", time.Second, true},
+	}
+	var limit limiter
+	for _, test := range tests {
+		got, _ := limit.allow(&test.config, test.source, start.Add(test.offset))
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLimiterSources(t *testing.T) {
+	config := Config{SourceRate: 1, SourceBurst: 1}
+	now := time.Now()
+	var limit limiter
+	if ok, _ := limit.allow(&config, "10.0.0.1", now); !ok {
+		t.Fatal("first request from source limited")
+	}
+	ok, retry := limit.allow(&config, "10.0.0.1", now)
+	if ok || retry <= 0 || retry > time.Second {
+		t.Fatalf("second request from source got %v %v", ok, retry)
+	}
+	if ok, _ := limit.allow(&config, "10.0.0.2", now); !ok {
+		t.Fatal("other source limited")
+	}
+
+	later := now.Add(2 * sourceIdle)
+	limit.allow(&config, "10.0.0.3", later)
+	if len(limit.sources) != 1 {
+		t.Fatalf("idle sources not pruned, %d left", len(limit.sources))
+	}
+}
+
+func TestLimiterCapacity(t *testing.T) {
+	config := Config{SourceRate: 1, SourceBurst: 1}
+	now := time.Now()
+	var limit limiter
+	for count := 0; count <= maxSources; count++ {
+		limit.allow(&config, fmt.Sprintf("10.0.%d.%d", count/256, count%256), now.Add(time.Duration(count)*time.Millisecond))
+	}
+	if len(limit.sources) != maxSources {
+		t.Fatalf("got %d sources, want %d", len(limit.sources), maxSources)
+	}
+	if _, ok := limit.sources["10.0.0.0"]; ok {
+		t.Error("oldest source not evicted")
+	}
+}
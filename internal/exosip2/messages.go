@@ -0,0 +1,88 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// get call id of a sip message
+func callId(msg *C.osip_message_t) string {
+	if msg == nil || msg.call_id == nil || msg.call_id.number == nil {
+		return ""
+	}
+	if msg.call_id.host == nil {
+		return C.GoString(msg.call_id.number)
+	}
+	return C.GoString(msg.call_id.number) + "@" + C.GoString(msg.call_id.host)
+}
+
+// map response to the originating message transaction, since an
+// authentication retry of a message will use a new transaction.
+func (ctx *Context) sentTran(msg *C.osip_message_t, tid int) int {
+	id := callId(msg)
+	ctx.Lock()
+	defer ctx.Unlock()
+	orig, ok := ctx.messages[id]
+	if !ok {
+		return tid
+	}
+	delete(ctx.messages, id)
+	return orig
+}
+
+// SendMessage sends a sip MESSAGE thru the current route.  The final
+// response is delivered as an EVT_SENT event with the returned tid.
+func (ctx *Context) SendMessage(to, from, contentType string, body []byte) (int, error) {
+	if len(from) < 1 {
+		from = ctx.GetIdentity()
+	}
+	if len(to) < 1 || len(from) < 1 {
+		return -1, fmt.Errorf("message address incomplete")
+	}
+
+	cs_method := C.CString("MESSAGE")
+	cs_to := C.CString(to)
+	cs_from := C.CString(from)
+	defer C.free(unsafe.Pointer(cs_method))
+	defer C.free(unsafe.Pointer(cs_to))
+	defer C.free(unsafe.Pointer(cs_from))
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	cs_route := ctx.looseRoute()
+	defer C.free(unsafe.Pointer(cs_route))
+	var msg *C.osip_message_t
+	result := int(C.eXosip_message_build_request(ctx.context, &msg, cs_method, cs_to, cs_from, cs_route))
+	if result != 0 {
+		return -1, fmt.Errorf("message build failed; code=%d", result)
+	}
+	setBody(msg, contentType, body)
+	id := callId(msg)
+	tid := int(C.eXosip_message_send_request(ctx.context, msg))
+	if tid < 0 {
+		return -1, fmt.Errorf("message send failed; code=%d", tid)
+	}
+	ctx.messages[id] = tid
+	return tid, nil
+}
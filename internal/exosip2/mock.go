@@ -0,0 +1,498 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// reply or request captured by a Mock
+type MockReply struct {
+	Type     EVT_TYPE
+	Method   string
+	Status   SIP_STATUS
+	Call     int
+	Tran     int
+	Dialog   int
+	To       string
+	From     string
+	Content  string
+	Body     []byte
+	Contacts []string
+}
+
+// Mock is an in-memory Agent that delivers injected events and captures
+// replies and requests, for testing without libeXosip2.
+type Mock struct {
+	Config
+	Host string
+	Port int
+
+	lock     sync.Mutex
+	inject   chan Event
+	done     chan struct{} // closed with the mock
+	closed   bool
+	route    string
+	realm    string
+	acl      *ACL
+	registry map[string]*registration
+	watchers map[int]string // accepted subscriptions by dialog
+	subs     map[int]bool
+	identity string
+	tid      int
+	replies  []MockReply
+}
+
+var _ Agent = (*Mock)(nil)
+
+func NewMock(config Config) *Mock {
+	return &Mock{Config: config, route: config.Server, inject: make(chan Event, 64), done: make(chan struct{}), registry: make(map[string]*registration), watchers: make(map[int]string), subs: make(map[int]bool)}
+}
+
+func (mock *Mock) nextTran() int {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.tid++
+	return mock.tid
+}
+
+func (mock *Mock) capture(reply MockReply) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.replies = append(mock.replies, reply)
+}
+
+// Inject an event into the mock event loop, returning the tid used, or
+// -1 if the mock is closed.
+func (mock *Mock) Inject(event Event) int {
+	event.Context = mock
+	if event.Tran < 1 {
+		event.Tran = mock.nextTran()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	switch event.Type {
+	case EVT_MESSAGE, EVT_CALL_INVITE, EVT_SUBSCRIBE:
+		mock.lock.Lock()
+		acl := mock.acl
+		mock.lock.Unlock()
+		if !acl.Permit(event.From) {
+			event.Reply(SIP_FORBIDDEN)
+			event.Type = EVT_INVALID
+		}
+	}
+	select {
+	case <-mock.done:
+		return -1
+	default:
+	}
+	select {
+	case mock.inject <- event:
+		return event.Tran
+	case <-mock.done:
+		return -1
+	}
+}
+
+// Message injects a received MESSAGE request
+func (mock *Mock) Message(from, to, content string, body []byte) int {
+	parts, _ := decodeParts(content, "", body)
+	return mock.Inject(Event{Type: EVT_MESSAGE, Status: SIP_OK, Method: "MESSAGE", Uri: to, From: from, To: to, Content: content, Body: body, Parts: parts, Call: -1, Dialog: -1, Expires: -1})
+}
+
+// Replies captured so far
+func (mock *Mock) Replies() []MockReply {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]MockReply(nil), mock.replies...)
+}
+
+// Find captured reply for a transaction
+func (mock *Mock) Find(tid int) (MockReply, bool) {
+	for _, reply := range mock.Replies() {
+		if reply.Tran == tid {
+			return reply, true
+		}
+	}
+	return MockReply{}, false
+}
+
+func (mock *Mock) Register(identity, user, secret string) error {
+	return mock.RegisterRefresh(identity, user, secret, mock.Refresh)
+}
+
+// RegisterRefresh registers immediately, injecting a register event
+func (mock *Mock) RegisterRefresh(identity, user, secret string, refresh int) error {
+	mock.lock.Lock()
+	if mock.closed {
+		mock.lock.Unlock()
+		return fmt.Errorf("mock closed")
+	}
+	reg, ok := mock.registry[identity]
+	if ok && user == reg.username && secret == reg.password && refresh == reg.refresh {
+		mock.lock.Unlock()
+		return nil
+	}
+	mock.registry[identity] = &registration{identity: identity, username: user, password: secret, refresh: refresh, expires: refresh, online: true, success: time.Now()}
+	if len(mock.identity) < 1 {
+		mock.identity = identity
+	}
+	mock.lock.Unlock()
+	mock.Inject(Event{Type: EVT_REGISTER, Status: SIP_OK, Call: -1, Dialog: -1, Expires: refresh, Identity: identity})
+	return nil
+}
+
+func (mock *Mock) Unregister() {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.registry = make(map[string]*registration)
+	mock.identity = ""
+}
+
+func (mock *Mock) UnregisterIdentity(identity string) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	delete(mock.registry, identity)
+	if mock.identity == identity {
+		mock.identity = ""
+	}
+}
+
+func (mock *Mock) ListenAndServe(address string, out chan<- Event) error {
+	return mock.ListenAndServeContext(context.Background(), address, out)
+}
+
+// ListenAndServeContext delivers injected events until closed or cancelled
+func (mock *Mock) ListenAndServeContext(parent context.Context, address string, out chan<- Event) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	mock.lock.Lock()
+	mock.Host, mock.Port = host, number
+	mock.lock.Unlock()
+
+	out <- Event{Context: mock, Type: EVT_STARTUP, Status: SIP_OK, Call: -1, Tran: -1, Dialog: -1, Expires: -1, Timestamp: time.Now()}
+	for done := false; !done; {
+		select {
+		case event := <-mock.inject:
+			out <- event
+		case <-mock.done:
+			done = true
+		case <-parent.Done():
+			done = true
+		}
+	}
+	out <- Event{Context: nil, Type: EVT_SHUTDOWN, Status: SIP_OK, Call: -1, Tran: -1, Dialog: -1, Expires: -1, Timestamp: time.Now()}
+	mock.Unregister()
+	return nil
+}
+
+func (mock *Mock) Close() {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	if !mock.closed {
+		mock.closed = true
+		close(mock.done)
+	}
+}
+
+func (mock *Mock) Reply(event *Event, status SIP_STATUS) {
+	event.Status = status
+	mock.capture(MockReply{Type: event.Type, Status: status, Call: event.Call, Tran: event.Tran, Dialog: event.Dialog, To: event.From, From: event.To})
+	if event.Type == EVT_SUBSCRIBE && status < 300 {
+		mock.lock.Lock()
+		defer mock.lock.Unlock()
+		mock.watchers[event.Dialog] = event.Package
+	}
+}
+
+func (mock *Mock) SetRoute(route string) bool {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	if route == mock.route {
+		return false
+	}
+	mock.route = route
+	return true
+}
+
+// SetAuthenticator records the realm, injected events are not challenged
+func (mock *Mock) SetAuthenticator(realm string, lookup Lookup) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.realm = realm
+}
+
+// SetACL applies access rules to injected requests
+func (mock *Mock) SetACL(acl *ACL) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.acl = acl
+}
+
+func (mock *Mock) SendMessage(to, from, contentType string, body []byte) (int, error) {
+	if len(from) < 1 {
+		from = mock.GetIdentity()
+	}
+	if len(to) < 1 || len(from) < 1 {
+		return -1, fmt.Errorf("message address incomplete")
+	}
+	tid := mock.nextTran()
+	mock.capture(MockReply{Type: EVT_SENT, Method: "MESSAGE", Call: -1, Tran: tid, Dialog: -1, To: to, From: from, Content: contentType, Body: body})
+	return tid, nil
+}
+
+func (mock *Mock) Invite(to, from, content string, body []byte) (int, error) {
+	if len(from) < 1 {
+		from = mock.GetIdentity()
+	}
+	if len(to) < 1 || len(from) < 1 {
+		return -1, fmt.Errorf("call address incomplete")
+	}
+	cid := mock.nextTran()
+	mock.capture(MockReply{Type: EVT_CALL_INVITE, Method: "INVITE", Call: cid, Tran: -1, Dialog: -1, To: to, From: from, Content: content, Body: body})
+	return cid, nil
+}
+
+func (mock *Mock) Answer(tid int, status SIP_STATUS, content string, body []byte) error {
+	if tid < 0 {
+		return fmt.Errorf("invalid call transaction")
+	}
+	mock.capture(MockReply{Type: EVT_CALL_INVITE, Status: status, Call: -1, Tran: tid, Dialog: -1, Content: content, Body: body})
+	return nil
+}
+
+func (mock *Mock) Ringing(tid int) error {
+	return mock.Answer(tid, SIP_RINGING, "", nil)
+}
+
+func (mock *Mock) Reject(tid int, status SIP_STATUS) error {
+	if status < 300 {
+		return fmt.Errorf("invalid reject status %d", status)
+	}
+	return mock.Answer(tid, status, "", nil)
+}
+
+func (mock *Mock) Hangup(cid, did int) error {
+	if cid < 0 {
+		return fmt.Errorf("invalid call")
+	}
+	mock.capture(MockReply{Type: EVT_CALL_CLOSED, Method: "BYE", Call: cid, Tran: -1, Dialog: did})
+	return nil
+}
+
+func (mock *Mock) SendDTMF(did int, digit string, duration time.Duration) error {
+	if did < 0 {
+		return fmt.Errorf("invalid call dialog")
+	}
+	body, err := dtmfRelay(digit, duration)
+	if err != nil {
+		return err
+	}
+	mock.capture(MockReply{Type: EVT_DTMF, Method: "INFO", Call: -1, Tran: -1, Dialog: did, Content: DTMF_RELAY_CONTENT, Body: body})
+	return nil
+}
+
+func (mock *Mock) Transfer(did int, target string) error {
+	if did < 0 || len(target) < 1 {
+		return fmt.Errorf("invalid call transfer")
+	}
+	mock.capture(MockReply{Type: EVT_REFER, Method: "REFER", Call: -1, Tran: -1, Dialog: did, To: target})
+	return nil
+}
+
+func (mock *Mock) AttendedTransfer(did, consult int) error {
+	if did < 0 || consult < 0 {
+		return fmt.Errorf("invalid call transfer")
+	}
+	mock.capture(MockReply{Type: EVT_REFER, Method: "REFER", Call: -1, Tran: -1, Dialog: did, To: fmt.Sprintf("dialog:%d", consult)})
+	return nil
+}
+
+func (mock *Mock) TransferStatus(did int, status SIP_STATUS) error {
+	if did < 0 || status < 100 {
+		return fmt.Errorf("invalid transfer status")
+	}
+	frag := fmt.Sprintf("SIP/2.0 %d\r\n", status)
+	mock.capture(MockReply{Type: EVT_TRANSFER, Method: "NOTIFY", Status: status, Call: -1, Tran: -1, Dialog: did, Content: SIPFRAG_CONTENT, Body: []byte(frag)})
+	return nil
+}
+
+func (mock *Mock) Redirect(event *Event, contacts ...string) error {
+	if len(contacts) < 1 {
+		return fmt.Errorf("no redirect contacts")
+	}
+	event.Status = SIP_MOVED_TEMPORARILY
+	mock.capture(MockReply{Type: event.Type, Status: event.Status, Call: event.Call, Tran: event.Tran, Dialog: event.Dialog, To: event.From, From: event.To, Contacts: contacts})
+	return nil
+}
+
+func (mock *Mock) Subscribe(to, from, pkg string, expires int) (int, error) {
+	if len(from) < 1 {
+		from = mock.GetIdentity()
+	}
+	if len(to) < 1 || len(from) < 1 || len(pkg) < 1 {
+		return -1, fmt.Errorf("subscribe address incomplete")
+	}
+	sid := mock.nextTran()
+	mock.capture(MockReply{Type: EVT_SUBSCRIBED, Method: "SUBSCRIBE", Call: -1, Tran: sid, Dialog: -1, To: to, From: from, Content: pkg})
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.subs[sid] = true
+	return sid, nil
+}
+
+func (mock *Mock) Unsubscribe(sid int) error {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	if !mock.subs[sid] {
+		return fmt.Errorf("invalid subscription")
+	}
+	delete(mock.subs, sid)
+	return nil
+}
+
+func (mock *Mock) Notify(did int, state SUB_STATE, content string, body []byte) error {
+	mock.lock.Lock()
+	_, ok := mock.watchers[did]
+	if state == SUB_TERMINATED {
+		delete(mock.watchers, did)
+	}
+	mock.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("invalid subscription")
+	}
+	mock.capture(MockReply{Type: EVT_NOTIFY, Method: "NOTIFY", Call: -1, Tran: -1, Dialog: did, Content: content, Body: body})
+	return nil
+}
+
+func (mock *Mock) Publish(pkg, content string, body []byte) int {
+	var dialogs []int
+	mock.lock.Lock()
+	for did, watch := range mock.watchers {
+		if watch == pkg {
+			dialogs = append(dialogs, did)
+		}
+	}
+	mock.lock.Unlock()
+	for _, did := range dialogs {
+		mock.Notify(did, SUB_ACTIVE, content, body)
+	}
+	return len(dialogs)
+}
+
+func (mock *Mock) GetAddress() string {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return net.JoinHostPort(mock.Host, strconv.Itoa(mock.Port))
+}
+
+func (mock *Mock) GetIdentity() string {
+	list := mock.GetIdentities()
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	if _, ok := mock.registry[mock.identity]; ok {
+		return mock.identity
+	}
+	if len(list) < 1 {
+		return ""
+	}
+	return list[0]
+}
+
+func (mock *Mock) GetIdentities() []string {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	list := make([]string, 0, len(mock.registry))
+	for identity := range mock.registry {
+		list = append(list, identity)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (mock *Mock) GetSchema() string {
+	return "sip:"
+}
+
+func (mock *Mock) IsOpen() bool {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return !mock.closed
+}
+
+func (mock *Mock) IsActive() bool {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return len(mock.registry) > 0
+}
+
+func (mock *Mock) IsOnline() bool {
+	return mock.IsActive()
+}
+
+func (mock *Mock) IsRegistered(identity string) bool {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	_, ok := mock.registry[identity]
+	return ok
+}
+
+// IsReachable is true for an open mock with a route
+func (mock *Mock) IsReachable() bool {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return !mock.closed && len(mock.route) > 0
+}
+
+func (mock *Mock) GetLatency() time.Duration {
+	return 0
+}
+
+func (mock *Mock) Snapshot() Snapshot {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	snap := Snapshot{
+		Open:      !mock.closed,
+		Address:   net.JoinHostPort(mock.Host, strconv.Itoa(mock.Port)),
+		Public:    mock.Public,
+		Route:     mock.route,
+		Identity:  mock.identity,
+		Reachable: !mock.closed && len(mock.route) > 0,
+		Watchers:  len(mock.watchers),
+		Timestamp: time.Now(),
+	}
+	for _, reg := range mock.registry {
+		snap.Registrations = append(snap.Registrations, reg.snapshot())
+	}
+	sort.Slice(snap.Registrations, func(i, j int) bool {
+		return snap.Registrations[i].Identity < snap.Registrations[j].Identity
+	})
+	snap.Subscriptions = len(mock.subs)
+	return snap
+}
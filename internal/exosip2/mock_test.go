@@ -0,0 +1,169 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMockEvents(t *testing.T) {
+	mock := NewMock(Config{})
+	out := make(chan Event, 16)
+	go mock.ListenAndServe("127.0.0.1:5060", out)
+	if event := <-out; event.Type != EVT_STARTUP {
+		t.Fatalf("expected startup, got %v", event.Type)
+	}
+
+	tid := mock.Message("sip:alice@example.com", "sip:bob@example.com", "text/plain", []byte("hello"))
+	event := <-out
+	if event.Type != EVT_MESSAGE || event.Tran != tid {
+		t.Fatalf("expected message %d, got %v %d", tid, event.Type, event.Tran)
+	}
+	if part := event.Part("text/plain"); part == nil || string(part.Body) != "hello" {
+		t.Fatalf("message part missing")
+	}
+	event.Reply(SIP_OK)
+	if reply, ok := mock.Find(tid); !ok || reply.Status != SIP_OK || reply.To != "sip:alice@example.com" {
+		t.Fatalf("reply not captured: %+v", reply)
+	}
+
+	mock.Close()
+	if event := <-out; event.Type != EVT_SHUTDOWN {
+		t.Fatalf("expected shutdown, got %v", event.Type)
+	}
+}
+
+func TestMockClosed(t *testing.T) {
+	mock := NewMock(Config{})
+	mock.Close()
+	mock.Close()
+	if mock.IsOpen() {
+		t.Fatal("closed mock is open")
+	}
+	if tid := mock.Inject(Event{Type: EVT_MESSAGE}); tid != -1 {
+		t.Fatalf("inject after close returned %d", tid)
+	}
+	if err := mock.Register("sip:alice@example.com", "alice", "secret"); err == nil {
+		t.Fatal("register after close succeeded")
+	}
+}
+
+func TestMockACL(t *testing.T) {
+	acl, err := NewACL("", "spam.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := NewMock(Config{})
+	mock.SetACL(acl)
+	tests := []struct {
+		from string
+		want EVT_TYPE
+	}{
+		{"sip:alice@example.com", EVT_MESSAGE},
+		{"sip:bot@spam.example.com", EVT_INVALID},
+	}
+	for _, test := range tests {
+		tid := mock.Message(test.from, "sip:bob@example.com", "text/plain", []byte("hi"))
+		select {
+		case event := <-mock.inject:
+			if event.Type != test.want {
+				t.Errorf("%s: got %v, want %v", test.from, event.Type, test.want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: event not injected", test.from)
+		}
+		reply, ok := mock.Find(tid)
+		if test.want == EVT_INVALID && (!ok || reply.Status != SIP_FORBIDDEN) {
+			t.Errorf("%s: expected forbidden reply", test.from)
+		}
+	}
+}
+
+func TestMockRequests(t *testing.T) {
+	mock := NewMock(Config{})
+	tests := []struct {
+		name   string
+		send   func() error
+		method string
+		fails  bool
+	}{
+		{"message", func() error {
+			_, err := mock.SendMessage("sip:bob@example.com", "sip:alice@example.com", "text/plain", []byte("hi"))
+			return err
+		}, "MESSAGE", false},
+		{"message without from", func() error {
+			_, err := mock.SendMessage("sip:bob@example.com", "", "text/plain", nil)
+			return err
+		}, "", true},
+		{"dtmf", func() error { return mock.SendDTMF(1, "5", 250*time.Millisecond) }, "INFO", false},
+		{"dtmf invalid digit", func() error { return mock.SendDTMF(1, "x", 0) }, "", true},
+		{"transfer", func() error { return mock.Transfer(1, "sip:carol@example.com") }, "REFER", false},
+		{"transfer no target", func() error { return mock.Transfer(1, "") }, "", true},
+		{"hangup", func() error { return mock.Hangup(1, 2) }, "BYE", false},
+		{"reject success", func() error { return mock.Reject(1, SIP_OK) }, "", true},
+	}
+	for _, test := range tests {
+		count := len(mock.Replies())
+		err := test.send()
+		if (err != nil) != test.fails {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		replies := mock.Replies()
+		if test.fails {
+			if len(replies) != count {
+				t.Errorf("%s: failed request was captured", test.name)
+			}
+			continue
+		}
+		if len(replies) != count+1 || replies[count].Method != test.method {
+			t.Errorf("%s: expected %s captured", test.name, test.method)
+		}
+	}
+}
+
+func TestMockCloseBlocked(t *testing.T) {
+	mock := NewMock(Config{})
+	for count := 0; count < cap(mock.inject); count++ {
+		mock.Inject(Event{Type: EVT_MESSAGE})
+	}
+
+	// a blocked inject must not hold up close
+	result := make(chan int)
+	go func() {
+		result <- mock.Inject(Event{Type: EVT_MESSAGE})
+	}()
+	closed := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mock.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked by inject")
+	}
+	select {
+	case tid := <-result:
+		if tid != -1 {
+			t.Fatalf("blocked inject returned %d", tid)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("inject still blocked after close")
+	}
+}
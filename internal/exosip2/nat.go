@@ -0,0 +1,91 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"babylon/internal/stun"
+)
+
+// time allowed for stun lookup at startup
+const stunTimeout = 3 * time.Second
+
+// set public contact address from stun or config, after listening.  The
+// sip socket belongs to eXosip, so stun uses it's own socket and only finds
+// the public port of a port preserving nat.  Behind a nat that changes
+// ports, such as a symmetric nat, the public port must be configured.
+func (ctx *Context) masquerade(port int) error {
+	host, public, fixed := "", port, false
+	if len(ctx.Public) > 0 {
+		host = ctx.Public
+		if addr, number, err := net.SplitHostPort(ctx.Public); err == nil {
+			host, fixed = addr, true
+			public, err = strconv.Atoi(number)
+			if err != nil {
+				return fmt.Errorf("invalid public address %s", ctx.Public)
+			}
+		}
+	}
+
+	if len(ctx.Stun) > 0 && !ctx.Tcp && !ctx.Tls {
+		addr, preserved, err := stunLookup(ctx.Stun)
+		if err == nil && !preserved && !fixed {
+			return fmt.Errorf("stun nat changes ports; public port must be set")
+		}
+		if err == nil {
+			host = addr.IP.String()
+		} else if len(host) < 1 {
+			return fmt.Errorf("stun lookup failed; %v", err)
+		}
+	}
+
+	if len(host) < 1 {
+		return nil
+	}
+
+	cs_host := C.CString(host)
+	defer C.free(unsafe.Pointer(cs_host))
+	ctx.Lock()
+	defer ctx.Unlock()
+	C.eXosip_masquerade_contact(ctx.context, cs_host, C.int(public))
+	ctx.public = net.JoinHostPort(host, strconv.Itoa(public))
+	return nil
+}
+
+// public address thru stun, and if the nat kept the local port
+func stunLookup(server string) (*net.UDPAddr, bool, error) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+	addr, err := stun.LookupConn(conn, server, stunTimeout)
+	if err != nil {
+		return nil, false, err
+	}
+	return addr, addr.Port == conn.LocalAddr().(*net.UDPAddr).Port, nil
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"unicode/utf16"
+)
+
+// limits on decoding untrusted bodies
+const (
+	maxDecoded = 1 << 20 // decoded size of a body, over all its parts
+	maxNesting = 4       // depth of nested multipart bodies
+)
+
+// Part of a message body, decoded and with text converted to utf-8
+type Part struct {
+	Content string            // media type, such as text/plain
+	Params  map[string]string // media type parameters, such as charset
+	Body    []byte
+}
+
+// Part finds the first body part of a media type
+func (event *Event) Part(content string) *Part {
+	for pos := range event.Parts {
+		if event.Parts[pos].Content == content {
+			return &event.Parts[pos]
+		}
+	}
+	return nil
+}
+
+// decode body parts from content type, content encoding, and raw body
+func decodeParts(content, encoding string, body []byte) ([]Part, error) {
+	remaining := maxDecoded
+	return decodeNested(content, encoding, body, 0, &remaining)
+}
+
+func decodeNested(content, encoding string, body []byte, depth int, remaining *int) ([]Part, error) {
+	if len(body) < 1 {
+		return nil, nil
+	}
+
+	data, err := decompress(encoding, body, *remaining)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < 1 {
+		content = "text/plain"
+	}
+
+	media, params, err := mime.ParseMediaType(content)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(media, "multipart/") {
+		if strings.HasPrefix(media, "text/") || len(params["charset"]) > 0 {
+			data, err = toUtf8(params["charset"], data)
+			if err != nil {
+				return nil, err
+			}
+			delete(params, "charset")
+		}
+		*remaining -= len(data)
+		if *remaining < 0 {
+			return nil, fmt.Errorf("decoded body too large")
+		}
+		return []Part{{Content: media, Params: params, Body: data}}, nil
+	}
+
+	if depth >= maxNesting {
+		return nil, fmt.Errorf("multipart nested too deep")
+	}
+
+	var parts []Part
+	reader := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+			raw, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(raw)), ""))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		nested, err := decodeNested(part.Header.Get("Content-Type"), part.Header.Get("Content-Encoding"), raw, depth+1, remaining)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, nested...)
+	}
+	return parts, nil
+}
+
+// decompress a body, up to a limit
+func decompress(encoding string, body []byte, limit int) ([]byte, error) {
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		// deflate should be zlib wrapped, but raw deflate is common
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			reader = flate.NewReader(bytes.NewReader(body))
+		} else {
+			defer zr.Close()
+			reader = zr
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("decompressed body too large")
+	}
+	return data, nil
+}
+
+// windows-1252 code points for 0x80 thru 0x9f
+var cp1252 = [32]rune{
+	0x20ac, 0xfffd, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0xfffd, 0x017d, 0xfffd,
+	0xfffd, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0xfffd, 0x017e, 0x0178,
+}
+
+func toUtf8(charset string, data []byte) ([]byte, error) {
+	name := strings.ToLower(strings.Trim(charset, "\" "))
+	switch name {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return data, nil
+	case "iso-8859-1", "latin1", "iso8859-1":
+		runes := make([]rune, len(data))
+		for pos, ch := range data {
+			runes[pos] = rune(ch)
+		}
+		return []byte(string(runes)), nil
+	case "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for pos, ch := range data {
+			if ch >= 0x80 && ch < 0xa0 {
+				runes[pos] = cp1252[ch-0x80]
+			} else {
+				runes[pos] = rune(ch)
+			}
+		}
+		return []byte(string(runes)), nil
+	case "utf-16", "utf-16be", "utf-16le":
+		return fromUtf16(name, data)
+	}
+	return nil, fmt.Errorf("unsupported charset %s", charset)
+}
+
+func fromUtf16(charset string, data []byte) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("invalid utf-16 text")
+	}
+
+	little := charset == "utf-16le"
+	if len(data) > 1 && charset == "utf-16" {
+		switch {
+		case data[0] == 0xff && data[1] == 0xfe:
+			little = true
+			data = data[2:]
+		case data[0] == 0xfe && data[1] == 0xff:
+			data = data[2:]
+		}
+	}
+
+	units := make([]uint16, len(data)/2)
+	for pos := range units {
+		if little {
+			units[pos] = uint16(data[pos*2]) | uint16(data[pos*2+1])<<8
+		} else {
+			units[pos] = uint16(data[pos*2])<<8 | uint16(data[pos*2+1])
+		}
+	}
+	return []byte(string(utf16.Decode(units))), nil
+}
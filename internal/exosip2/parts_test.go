@@ -0,0 +1,128 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func gzipped(text string) []byte {
+	var out bytes.Buffer
+	gz := gzip.NewWriter(&out)
+	gz.Write([]byte(text))
+	gz.Close()
+	return out.Bytes()
+}
+
+func TestDecodeParts(t *testing.T) {
+	multipart := "--b1\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--b1\r\nContent-Type: application/json\r\nContent-Transfer-Encoding: base64\r\n\r\neyJhIjoxfQ==\r\n" +
+		"--b1--\r\n"
+	tests := []struct {
+		content  string
+		encoding string
+		body     []byte
+		want     []Part
+	}{
+		{"", "", nil, nil},
+		{"", "", []byte("plain"), []Part{{Content: "text/plain", Body: []byte("plain")}}},
+		{"text/plain;charset=iso-8859-1", "", []byte("caf\xe9"), []Part{{Content: "text/plain", Body: []byte("café")}}},
+		{"text/plain", "gzip", gzipped("packed"), []Part{{Content: "text/plain", Body: []byte("packed")}}},
+		{`text/plain;charset="UTF-16LE"`, "", []byte("h\x00i\x00"), []Part{{Content: "text/plain", Body: []byte("hi")}}},
+		{"text/plain;charset=utf-16", "", []byte("\xff\xfeh\x00"), []Part{{Content: "text/plain", Body: []byte("h")}}},
+		{"text/plain;charset=UTF-16BE", "", []byte("\x00h"), []Part{{Content: "text/plain", Body: []byte("h")}}},
+		{"multipart/mixed;boundary=b1", "", []byte(multipart), []Part{{Content: "text/plain", Body: []byte("hello")}, {Content: "application/json", Body: []byte(`{"a":1}`)}}},
+	}
+	for _, test := range tests {
+		parts, err := decodeParts(test.content, test.encoding, test.body)
+		if err != nil {
+			t.Errorf("%q: %v", test.content, err)
+			continue
+		}
+		if len(parts) != len(test.want) {
+			t.Errorf("%q: got %d parts, want %d", test.content, len(parts), len(test.want))
+			continue
+		}
+		for pos, part := range parts {
+			if part.Content != test.want[pos].Content || !bytes.Equal(part.Body, test.want[pos].Body) {
+				t.Errorf("%q: part %d got %s %q", test.content, pos, part.Content, part.Body)
+			}
+		}
+	}
+}
+
+// multipart body nested to a given depth around a text part
+func nested(depth int) []byte {
+	body := "text"
+	content := "text/plain"
+	for level := depth - 1; level >= 0; level-- {
+		boundary := fmt.Sprintf("b%d", level)
+		body = "--" + boundary + "\r\nContent-Type: " + content + "\r\n\r\n" + body + "\r\n--" + boundary + "--\r\n"
+		content = "multipart/mixed;boundary=" + boundary
+	}
+	return []byte(body)
+}
+
+func TestDecodePartsNested(t *testing.T) {
+	parts, err := decodeParts("multipart/mixed;boundary=b0", "", nested(maxNesting))
+	if err != nil || len(parts) != 1 || string(parts[0].Body) != "text" {
+		t.Fatalf("got %v %v", parts, err)
+	}
+}
+
+// multipart body of gzipped parts, each decoding to size bytes
+func manyParts(count, size int) []byte {
+	var out bytes.Buffer
+	packed := base64.StdEncoding.EncodeToString(gzipped(strings.Repeat("x", size)))
+	for pos := 0; pos < count; pos++ {
+		out.WriteString("--b1\r\nContent-Type: text/plain\r\nContent-Encoding: gzip\r\nContent-Transfer-Encoding: base64\r\n\r\n" + packed + "\r\n")
+	}
+	out.WriteString("--b1--\r\n")
+	return out.Bytes()
+}
+
+func TestDecodePartsLimit(t *testing.T) {
+	parts, err := decodeParts("multipart/mixed;boundary=b1", "", manyParts(2, maxDecoded/2))
+	if err != nil || len(parts) != 2 {
+		t.Fatalf("parts within limit; got %d %v", len(parts), err)
+	}
+}
+
+func TestDecodePartsInvalid(t *testing.T) {
+	tests := []struct {
+		content  string
+		encoding string
+		body     []byte
+	}{
+		{"text/plain", "compress", []byte("data")},
+		{"text/plain", "gzip", []byte("not gzip")},
+		{"text/plain;charset=klingon", "", []byte("data")},
+		{"text/", "", []byte("data")},
+		{"text/plain", "gzip", gzipped(strings.Repeat("x", maxDecoded+1))},
+		{"multipart/mixed;boundary=b0", "", nested(maxNesting + 1)},
+		{"multipart/mixed;boundary=b1", "", manyParts(3, maxDecoded/2)},
+	}
+	for _, test := range tests {
+		if _, err := decodeParts(test.content, test.encoding, test.body); err == nil {
+			t.Errorf("%q %q: expected error", test.content, test.encoding)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	PIDF_CONTENT    = "application/pidf+xml"
+	DIALOG_CONTENT  = "application/dialog-info+xml"
+	SUMMARY_CONTENT = "application/simple-message-summary"
+)
+
+// content accepted for well known event packages
+var packages = map[string]string{
+	"presence":        PIDF_CONTENT,
+	"dialog":          DIALOG_CONTENT,
+	"message-summary": SUMMARY_CONTENT,
+}
+
+func escape(text string) string {
+	var out bytes.Buffer
+	xml.EscapeText(&out, []byte(text))
+	return out.String()
+}
+
+// PresenceBody creates a pidf document for an entity, with basic open or
+// closed status and an optional note.
+func PresenceBody(entity string, open bool, note string) []byte {
+	basic := "closed"
+	if open {
+		basic = "open"
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n")
+	fmt.Fprintf(&out, "<presence xmlns=\"urn:ietf:params:xml:ns:pidf\" entity=\"%s\">\r\n", escape(entity))
+	fmt.Fprintf(&out, "<tuple id=\"t1\"><status><basic>%s</basic></status>", basic)
+	if len(note) > 0 {
+		fmt.Fprintf(&out, "<note>%s</note>", escape(note))
+	}
+	fmt.Fprintf(&out, "</tuple>\r\n</presence>\r\n")
+	return out.Bytes()
+}
+
+// DialogBody creates a dialog-info document for blf, where state is
+// usually confirmed, early, or terminated.  An empty state means idle.
+func DialogBody(entity string, version int, state string) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n")
+	fmt.Fprintf(&out, "<dialog-info xmlns=\"urn:ietf:params:xml:ns:dialog-info\" version=\"%d\" state=\"full\" entity=\"%s\">\r\n", version, escape(entity))
+	if len(state) > 0 {
+		fmt.Fprintf(&out, "<dialog id=\"1\" direction=\"recipient\"><state>%s</state></dialog>\r\n", escape(state))
+	}
+	fmt.Fprintf(&out, "</dialog-info>\r\n")
+	return out.Bytes()
+}
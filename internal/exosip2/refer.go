@@ -0,0 +1,66 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const SIPFRAG_CONTENT = "message/sipfrag"
+
+// parse the status line of a sipfrag transfer progress body
+func parseSipfrag(body []byte) (SIP_STATUS, error) {
+	line := strings.SplitN(string(body), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(strings.ToUpper(fields[0]), "SIP/") {
+		return SIP_UNKNOWN, fmt.Errorf("invalid sipfrag %s", line)
+	}
+	status, err := strconv.Atoi(fields[1])
+	if err != nil || status < 100 || status > 699 {
+		return SIP_UNKNOWN, fmt.Errorf("invalid sipfrag status %s", fields[1])
+	}
+	return SIP_STATUS(status), nil
+}
+
+// split a refer-to header into it's target and replaces dialog
+func parseReferTo(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	if start := strings.IndexByte(value, '<'); start > -1 {
+		value = value[start+1:]
+		if end := strings.IndexByte(value, '>'); end > -1 {
+			value = value[:end]
+		}
+	}
+
+	target, query := value, ""
+	if pos := strings.IndexByte(value, '?'); pos > -1 {
+		target, query = value[:pos], value[pos+1:]
+	}
+	for _, header := range strings.Split(query, "&") {
+		pair := strings.SplitN(header, "=", 2)
+		if len(pair) < 2 || !strings.EqualFold(pair[0], "replaces") {
+			continue
+		}
+		replaces, err := url.PathUnescape(pair[1])
+		if err == nil {
+			return target, replaces
+		}
+	}
+	return target, ""
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import "testing"
+
+func TestParseSipfrag(t *testing.T) {
+	tests := []struct {
+		body  string
+		want  SIP_STATUS
+		fails bool
+	}{
+		{"SIP/2.0 100 Trying", SIP_TRYING, false},
+		{"SIP/2.0 200 OK\r\nContent-Length: 0\r\n", SIP_OK, false},
+		{"sip/2.0 486 Busy Here", SIP_BUSY_HERE, false},
+		{"SIP/2.0 99 Bad", SIP_UNKNOWN, true},
+		{"HTTP/1.1 200 OK", SIP_UNKNOWN, true},
+		{"SIP/2.0", SIP_UNKNOWN, true},
+		{"", SIP_UNKNOWN, true},
+	}
+	for _, test := range tests {
+		status, err := parseSipfrag([]byte(test.body))
+		if (err != nil) != test.fails || status != test.want {
+			t.Errorf("%q: got %d %v, want %d", test.body, status, err, test.want)
+		}
+	}
+}
+
+func TestParseReferTo(t *testing.T) {
+	tests := []struct {
+		value    string
+		target   string
+		replaces string
+	}{
+		{"sip:carol@example.com", "sip:carol@example.com", ""},
+		{"<sip:carol@example.com>", "sip:carol@example.com", ""},
+		{"Carol <sip:carol@example.com>;tag=1", "sip:carol@example.com", ""},
+		{"<sip:carol@example.com?Replaces=abc%40host%3Bto-tag%3D1%3Bfrom-tag%3D2>", "sip:carol@example.com", "abc@host;to-tag=1;from-tag=2"},
+		{"<sip:carol@example.com?Require=replaces&replaces=id>", "sip:carol@example.com", "id"},
+	}
+	for _, test := range tests {
+		target, replaces := parseReferTo(test.value)
+		if target != test.target || replaces != test.replaces {
+			t.Errorf("%q: got %q %q, want %q %q", test.value, target, replaces, test.target, test.replaces)
+		}
+	}
+}
+
+func TestTransferNotReplied(t *testing.T) {
+	// progress of our own refer, or a notify already answered, must not
+	// get a fallback or access reply from the router
+	acl, err := NewACL("", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := NewMock(Config{})
+	router := NewRouter(1)
+	router.Use(AccessControl(acl), RequireUser())
+	for _, method := range []string{"REFER", "NOTIFY"} {
+		event := Event{Context: mock, Type: EVT_TRANSFER, Method: method, Status: SIP_OK, From: "sip:bob@example.com", Tran: 1, Dialog: 2}
+		router.Dispatch(&event)
+	}
+	if replies := mock.Replies(); len(replies) > 0 {
+		t.Fatalf("transfer events replied: %+v", replies)
+	}
+}
@@ -28,5 +28,28 @@ const (
 	EVT_SHUTDOWN
 	EVT_INVALID
 	EVT_REGISTER
+	EVT_RETRY
 	EVT_MESSAGE
+	EVT_SENT
+
+	EVT_PEER_UP
+	EVT_PEER_DOWN
+
+	EVT_SUBSCRIBE
+	EVT_SUBSCRIBED
+	EVT_NOTIFY
+
+	EVT_CALL_INVITE
+	EVT_CALL_REINVITE
+	EVT_CALL_ACK
+	EVT_CALL_RINGING
+	EVT_CALL_ANSWERED
+	EVT_CALL_FAILED
+	EVT_CALL_CANCELLED
+	EVT_CALL_CLOSED
+	EVT_CALL_RELEASED
+	EVT_CALL_REDIRECTED
+	EVT_DTMF
+	EVT_REFER
+	EVT_TRANSFER
 )
@@ -0,0 +1,92 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"math/rand"
+	"time"
+)
+
+// first retry delay, doubled for each further attempt
+const retryBase = 5 * time.Second
+
+// schedule a registration retry after failure, lock must be held
+func (ctx *Context) backoff(reg *registration, response *C.osip_message_t, event *Event) {
+	if ctx.closed {
+		return
+	}
+
+	reg.attempt++
+	delay := retryBase << (reg.attempt - 1)
+	limit := time.Duration(ctx.Backoff) * time.Second
+	if delay <= 0 || delay > limit {
+		delay = limit
+	}
+
+	// jitter retries so many agents do not return together
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	switch event.Status {
+	case SIP_INTERVAL_TOO_BRIEF:
+		if minimum := headerInt(response, "min-expires"); minimum > reg.expires {
+			reg.expires = minimum
+			delay = time.Second
+		}
+	case SIP_SERVICE_UNAVAILABLE, SIP_TEMPORARILY_UNAVAILABLE, SIP_BUSY_HERE:
+		if after := headerInt(response, "retry-after"); after > 0 {
+			delay = time.Duration(after) * time.Second
+		}
+	}
+
+	reg.retry = time.Now().Add(delay)
+	event.Attempt = reg.attempt
+	event.Retry = delay
+}
+
+// re-register failed registrations that are due, returning attempt events
+func (ctx *Context) reregister() []Event {
+	var events []Event
+	now := time.Now()
+	ctx.Lock()
+	defer ctx.Unlock()
+	for _, reg := range ctx.registry {
+		if reg.retry.IsZero() || now.Before(reg.retry) {
+			continue
+		}
+
+		reg.retry = time.Time{}
+		reg.fails = 0
+		if reg.rid > -1 {
+			C.eXosip_register_remove(ctx.context, C.int(reg.rid))
+		}
+
+		event := Event{Context: ctx, Type: EVT_RETRY, Status: SIP_TRYING, Call: -1, Tran: -1, Dialog: -1, Expires: reg.expires, Identity: reg.identity, Attempt: reg.attempt, Timestamp: now}
+		if ctx.sendRegister(reg) < 0 {
+			event.Status = SIP_SERVICE_UNAVAILABLE
+			reg.failures++
+			reg.failure = now
+			ctx.backoff(reg, nil, &event)
+		}
+		events = append(events, event)
+	}
+	return events
+}
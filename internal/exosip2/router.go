@@ -0,0 +1,289 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"hash/fnv"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Handler processes an event delivered by a router
+type Handler func(event *Event)
+
+// Middleware wraps a handler, such as for logging or access checks
+type Middleware func(next Handler) Handler
+
+// Match narrows a route by request method, content type, and a to uri
+// pattern such as sip:88@*.  Empty fields match anything.
+type Match struct {
+	Method  string
+	Content string
+	To      string
+}
+
+type route struct {
+	kind    EVT_TYPE
+	match   Match
+	handler Handler
+}
+
+// Router dispatches events from an agent to handlers by event type using
+// a pool of workers.  Events of the same call or dialog are kept in order
+// on one worker.  Requests nobody handles get 405, or 488 if only the
+// content type was not matched.
+type Router struct {
+	lock       sync.RWMutex
+	routes     []route
+	middleware []Middleware
+	fallback   Handler
+	workers    int
+	depth      int
+}
+
+// NewRouter creates a router with a worker pool size
+func NewRouter(workers int) *Router {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Router{workers: workers, depth: 16}
+}
+
+// QueueDepth sets how many events each worker may hold before Serve
+// blocks, set before calling Serve
+func (router *Router) QueueDepth(depth int) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	if depth < 1 {
+		depth = 1
+	}
+	router.depth = depth
+}
+
+// Use adds middleware, the first added being outermost
+func (router *Router) Use(middleware ...Middleware) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	router.middleware = append(router.middleware, middleware...)
+}
+
+// Handle all events of a type
+func (router *Router) Handle(kind EVT_TYPE, handler Handler) {
+	router.HandleMatch(kind, Match{}, handler)
+}
+
+// HandleMatch routes events of a type that also match, checked in the
+// order routes were added
+func (router *Router) HandleMatch(kind EVT_TYPE, match Match, handler Handler) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	router.routes = append(router.routes, route{kind: kind, match: match, handler: handler})
+}
+
+// Fallback replaces the default handler for unrouted events
+func (router *Router) Fallback(handler Handler) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	router.fallback = handler
+}
+
+// Dispatch an event thru middleware to it's handler
+func (router *Router) Dispatch(event *Event) {
+	router.lock.RLock()
+	handler := router.resolve
+	for pos := len(router.middleware) - 1; pos >= 0; pos-- {
+		handler = router.middleware[pos](handler)
+	}
+	router.lock.RUnlock()
+	handler(event)
+}
+
+// Serve events until shutdown, which is dispatched once workers drain.
+// When a worker queue is full Serve stops reading until it drains, and
+// with OVERFLOW_BLOCK that stalls the agent event loop too, so handlers
+// that block for long should hand work off rather than run inline.
+func (router *Router) Serve(in <-chan Event) {
+	var active sync.WaitGroup
+	router.lock.RLock()
+	depth := router.depth
+	router.lock.RUnlock()
+	queues := make([]chan Event, router.workers)
+	for pos := range queues {
+		queues[pos] = make(chan Event, depth)
+		active.Add(1)
+		go func(queue <-chan Event) {
+			defer active.Done()
+			for event := range queue {
+				router.Dispatch(&event)
+			}
+		}(queues[pos])
+	}
+
+	var shutdown *Event
+	for event := range in {
+		if event.Type == EVT_SHUTDOWN {
+			shutdown = &event
+			break
+		}
+		queues[router.worker(&event)] <- event
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	active.Wait()
+	if shutdown != nil {
+		router.Dispatch(shutdown)
+	}
+}
+
+// worker for an event, so calls and dialogs stay ordered, and requests
+// from one sender stay in order while different senders spread out
+func (router *Router) worker(event *Event) int {
+	switch {
+	case event.Call > 0:
+		return event.Call % router.workers
+	case event.Dialog > 0:
+		return event.Dialog % router.workers
+	case !replied(event.Type):
+		return 0
+	}
+
+	key := event.From
+	if len(key) < 1 {
+		key = event.Header("call-id")
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.ToLower(key)))
+	return int(hash.Sum32() % uint32(router.workers))
+}
+
+// find and call the handler for an event
+func (router *Router) resolve(event *Event) {
+	router.lock.RLock()
+	var handler Handler
+	unmatched := false
+	for _, entry := range router.routes {
+		if entry.kind != event.Type {
+			continue
+		}
+		if !entry.match.method(event) || !entry.match.to(event) {
+			continue
+		}
+		if !entry.match.content(event) {
+			unmatched = true
+			continue
+		}
+		handler = entry.handler
+		break
+	}
+	if handler == nil {
+		handler = router.fallback
+	}
+	router.lock.RUnlock()
+
+	switch {
+	case handler != nil:
+		handler(event)
+	case !replied(event.Type):
+		return
+	case unmatched:
+		event.Reply(SIP_NOT_ACCEPTABLE_HERE)
+	default:
+		event.Reply(SIP_METHOD_NOT_ALLOWED)
+	}
+}
+
+func (match *Match) method(event *Event) bool {
+	return len(match.Method) < 1 || strings.EqualFold(match.Method, event.Method)
+}
+
+func (match *Match) content(event *Event) bool {
+	if len(match.Content) < 1 || strings.EqualFold(match.Content, event.Content) {
+		return true
+	}
+	return event.Part(match.Content) != nil
+}
+
+func (match *Match) to(event *Event) bool {
+	if len(match.To) < 1 {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(match.To), strings.ToLower(event.To))
+	return ok
+}
+
+// events for requests the application must reply to
+func replied(kind EVT_TYPE) bool {
+	switch kind {
+	case EVT_MESSAGE, EVT_CALL_INVITE, EVT_CALL_REINVITE, EVT_SUBSCRIBE, EVT_REFER:
+		return true
+	}
+	return false
+}
+
+// Logging middleware reports each event before it is handled
+func Logging(log func(args ...interface{})) Middleware {
+	return func(next Handler) Handler {
+		return func(event *Event) {
+			log("event ", event.Type, "; method=", event.Method, ", from=", event.From, ", status=", event.Status)
+			next(event)
+		}
+	}
+}
+
+// AccessControl middleware rejects requests an acl does not permit
+func AccessControl(acl *ACL) Middleware {
+	return func(next Handler) Handler {
+		return func(event *Event) {
+			if replied(event.Type) && !acl.Permit(event.From) {
+				event.Reply(SIP_FORBIDDEN)
+				return
+			}
+			next(event)
+		}
+	}
+}
+
+// RequireUser middleware rejects requests without an authenticated
+// digest user, or if users are listed, one of those users.
+func RequireUser(users ...string) Middleware {
+	return func(next Handler) Handler {
+		return func(event *Event) {
+			if replied(event.Type) && !allowedUser(event.User, users) {
+				event.Reply(SIP_FORBIDDEN)
+				return
+			}
+			next(event)
+		}
+	}
+}
+
+func allowedUser(user string, users []string) bool {
+	if len(user) < 1 {
+		return false
+	}
+	if len(users) < 1 {
+		return true
+	}
+	for _, allowed := range users {
+		if user == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package exosip2
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRouterWorker(t *testing.T) {
+	router := NewRouter(8)
+	tests := []struct {
+		event Event
+		want  int
+	}{
+		{Event{Type: EVT_CALL_INVITE, Call: 11}, 3},
+		{Event{Type: EVT_SUBSCRIBE, Dialog: 20}, 4},
+		{Event{Type: EVT_REGISTER}, 0},
+	}
+	for _, test := range tests {
+		if got := router.worker(&test.event); got != test.want {
+			t.Errorf("%v: got worker %d, want %d", test.event.Type, got, test.want)
+		}
+	}
+
+	first := router.worker(&Event{Type: EVT_MESSAGE, From: "sip:alice@example.com"})
+	for count := 0; count < 4; count++ {
+		if got := router.worker(&Event{Type: EVT_MESSAGE, From: "sip:Alice@example.com"}); got != first {
+			t.Fatalf("sender moved from worker %d to %d", first, got)
+		}
+	}
+}
+
+func TestRouterOrder(t *testing.T) {
+	router := NewRouter(4)
+	var lock sync.Mutex
+	received := make(map[string][]int)
+	router.Handle(EVT_MESSAGE, func(event *Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		received[event.From] = append(received[event.From], event.Tran)
+	})
+
+	senders := []string{"sip:a@example.com", "sip:b@example.com", "sip:c@example.com"}
+	in := make(chan Event, 100)
+	for tid := 0; tid < 90; tid++ {
+		in <- Event{Type: EVT_MESSAGE, From: senders[tid%len(senders)], Tran: tid}
+	}
+	close(in)
+	router.Serve(in)
+
+	for _, from := range senders {
+		list := received[from]
+		if len(list) != 30 {
+			t.Fatalf("%s: got %d messages", from, len(list))
+		}
+		for pos := 1; pos < len(list); pos++ {
+			if list[pos] < list[pos-1] {
+				t.Fatalf("%s: reordered %v", from, list)
+			}
+		}
+	}
+}
+
+func TestRouterResolve(t *testing.T) {
+	router := NewRouter(1)
+	var got string
+	router.HandleMatch(EVT_MESSAGE, Match{Content: "text/plain", To: "sip:88@*"}, func(event *Event) { got = "88" })
+	router.HandleMatch(EVT_MESSAGE, Match{Content: "text/plain"}, func(event *Event) { got = "text" })
+	router.HandleMatch(EVT_CALL_INVITE, Match{Method: "INVITE"}, func(event *Event) { got = "invite" })
+
+	tests := []struct {
+		event  Event
+		want   string
+		status SIP_STATUS
+	}{
+		{Event{Type: EVT_MESSAGE, To: "sip:88@pbx.local", Content: "text/plain"}, "88", 0},
+		{Event{Type: EVT_MESSAGE, To: "SIP:88@Example.com", Content: "text/plain"}, "88", 0},
+		{Event{Type: EVT_MESSAGE, To: "sip:880@pbx.local", Content: "text/plain"}, "text", 0},
+		{Event{Type: EVT_MESSAGE, To: "sip:99@pbx.local", Content: "multipart/mixed", Parts: []Part{{Content: "text/plain"}}}, "text", 0},
+		{Event{Type: EVT_CALL_INVITE, Method: "invite"}, "invite", 0},
+		{Event{Type: EVT_MESSAGE, To: "sip:88@pbx.local", Content: "text/html"}, "", SIP_NOT_ACCEPTABLE_HERE},
+		{Event{Type: EVT_SUBSCRIBE, To: "sip:88@pbx.local"}, "", SIP_METHOD_NOT_ALLOWED},
+		{Event{Type: EVT_REGISTER}, "", 0},
+	}
+	for _, test := range tests {
+		got = ""
+		router.Dispatch(&test.event)
+		if got != test.want || test.event.Status != test.status {
+			t.Errorf("%v to %s: got %q status %d, want %q status %d", test.event.Type, test.event.To, got, test.event.Status, test.want, test.status)
+		}
+	}
+
+	router.Fallback(func(event *Event) { got = "fallback" })
+	event := Event{Type: EVT_SUBSCRIBE}
+	router.Dispatch(&event)
+	if got != "fallback" || event.Status != 0 {
+		t.Fatalf("fallback not used: got %q status %d", got, event.Status)
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	router := NewRouter(1)
+	var order []string
+	layer := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(event *Event) {
+				order = append(order, name)
+				next(event)
+			}
+		}
+	}
+	router.Use(layer("first"), layer("second"))
+	router.Use(layer("third"))
+	router.Handle(EVT_MESSAGE, func(event *Event) { order = append(order, "handler") })
+
+	router.Dispatch(&Event{Type: EVT_MESSAGE})
+	want := []string{"first", "second", "third", "handler"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+
+	router.Use(RequireUser("alice"))
+	order = nil
+	event := Event{Type: EVT_MESSAGE, User: "bob"}
+	router.Dispatch(&event)
+	if event.Status != SIP_FORBIDDEN || len(order) != 3 {
+		t.Fatalf("require user: status %d, order %v", event.Status, order)
+	}
+}
+
+func TestRouterDepth(t *testing.T) {
+	router := NewRouter(1)
+	router.QueueDepth(0)
+	if router.depth != 1 {
+		t.Fatalf("got depth %d", router.depth)
+	}
+
+	count := 0
+	router.Handle(EVT_MESSAGE, func(event *Event) { count++ })
+	in := make(chan Event, 8)
+	for pos := 0; pos < 6; pos++ {
+		in <- Event{Type: EVT_MESSAGE, From: "sip:alice@example.com"}
+	}
+	in <- Event{Type: EVT_SHUTDOWN}
+	in <- Event{Type: EVT_MESSAGE, From: "sip:alice@example.com"}
+	close(in)
+	router.Serve(in)
+	if count != 6 {
+		t.Fatalf("got %d messages before shutdown", count)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// default subscription interval in seconds
+const subscribeExpires = 3600
+
+// accepted inbound subscription, by dialog
+type watcher struct {
+	did     int
+	pkg     string
+	from    string
+	expires time.Time
+}
+
+// Subscribe to an event package of a remote uri, such as presence or
+// message-summary.  Notifications are delivered as EVT_NOTIFY events.
+func (ctx *Context) Subscribe(to, from, pkg string, expires int) (int, error) {
+	if len(from) < 1 {
+		from = ctx.GetIdentity()
+	}
+	if len(to) < 1 || len(from) < 1 || len(pkg) < 1 {
+		return -1, fmt.Errorf("subscribe address incomplete")
+	}
+	if expires < 1 {
+		expires = subscribeExpires
+	}
+
+	cs_to := C.CString(to)
+	cs_from := C.CString(from)
+	cs_pkg := C.CString(pkg)
+	defer C.free(unsafe.Pointer(cs_to))
+	defer C.free(unsafe.Pointer(cs_from))
+	defer C.free(unsafe.Pointer(cs_pkg))
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	cs_route := ctx.looseRoute()
+	defer C.free(unsafe.Pointer(cs_route))
+	var msg *C.osip_message_t
+	result := int(C.eXosip_subscription_build_initial_subscribe(ctx.context, &msg, cs_to, cs_from, cs_route, cs_pkg, C.int(expires)))
+	if result != 0 {
+		return -1, fmt.Errorf("subscribe failed; code=%d", result)
+	}
+	if accept, ok := packages[pkg]; ok {
+		cs_accept := C.CString(accept)
+		defer C.free(unsafe.Pointer(cs_accept))
+		C.osip_message_set_accept(msg, cs_accept)
+	}
+	sid := int(C.eXosip_subscription_send_initial_request(ctx.context, msg))
+	if sid < 0 {
+		return -1, fmt.Errorf("subscribe failed; code=%d", sid)
+	}
+	ctx.subscriptions[sid] = -1
+	return sid, nil
+}
+
+// Unsubscribe ends a client subscription.  One not yet answered has no
+// dialog to end, so it is ended once answered.
+func (ctx *Context) Unsubscribe(sid int) error {
+	ctx.Lock()
+	defer ctx.Unlock()
+	did, ok := ctx.subscriptions[sid]
+	if !ok {
+		return fmt.Errorf("invalid subscription")
+	}
+
+	delete(ctx.subscriptions, sid)
+	if did < 1 {
+		ctx.cancelled[sid] = true
+		return nil
+	}
+	ctx.unsubscribe(did)
+	return nil
+}
+
+// send subscribe with expires 0 on a dialog, lock must be held
+func (ctx *Context) unsubscribe(did int) {
+	var msg *C.osip_message_t
+	if C.eXosip_subscription_build_refresh_request(ctx.context, C.int(did), &msg) == 0 {
+		cs_expires := C.CString("expires")
+		cs_zero := C.CString("0")
+		defer C.free(unsafe.Pointer(cs_expires))
+		defer C.free(unsafe.Pointer(cs_zero))
+		C.osip_message_set_header(msg, cs_expires, cs_zero)
+		if C.eXosip_subscription_send_refresh_request(ctx.context, C.int(did), msg) == 0 {
+			return
+		}
+	}
+	C.eXosip_subscription_remove(ctx.context, C.int(did))
+}
+
+// end a cancelled subscription once it has a dialog, lock must be held
+func (ctx *Context) dropCancelled(event *Event, ended bool) bool {
+	if !ctx.cancelled[event.Subscription] {
+		return false
+	}
+	if ended || event.Dialog > 0 {
+		delete(ctx.cancelled, event.Subscription)
+	}
+	if !ended && event.Dialog > 0 {
+		ctx.unsubscribe(event.Dialog)
+	}
+	return true
+}
+
+// Notify an accepted inbound subscription of current state
+func (ctx *Context) Notify(did int, state SUB_STATE, content string, body []byte) error {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if _, ok := ctx.watchers[did]; !ok {
+		return fmt.Errorf("invalid subscription")
+	}
+	return ctx.notify(did, state, C.DEACTIVATED, content, body)
+}
+
+// Publish state to every subscriber of an event package, returning the
+// number of subscribers notified.
+func (ctx *Context) Publish(pkg, content string, body []byte) int {
+	count := 0
+	ctx.Lock()
+	defer ctx.Unlock()
+	for did, watch := range ctx.watchers {
+		if watch.pkg == pkg && ctx.notify(did, SUB_ACTIVE, C.DEACTIVATED, content, body) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// send notify to a subscriber, lock must be held
+func (ctx *Context) notify(did int, state SUB_STATE, reason C.int, content string, body []byte) error {
+	if state == SUB_TERMINATED {
+		delete(ctx.watchers, did)
+	}
+
+	var msg *C.osip_message_t
+	result := int(C.eXosip_insubscription_build_notify(ctx.context, C.int(did), C.int(state), reason, &msg))
+	if result != 0 {
+		return fmt.Errorf("notify failed; code=%d", result)
+	}
+	setBody(msg, content, body)
+	result = int(C.eXosip_insubscription_send_request(ctx.context, C.int(did), msg))
+	if result != 0 {
+		return fmt.Errorf("notify failed; code=%d", result)
+	}
+	return nil
+}
+
+// record a subscription accepted by reply
+func (ctx *Context) watch(event *Event) {
+	expires := event.Expires
+	if expires < 0 {
+		expires = subscribeExpires
+	}
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.watchers[event.Dialog] = &watcher{did: event.Dialog, pkg: event.Package, from: event.From, expires: time.Now().Add(time.Duration(expires) * time.Second)}
+}
+
+// inbound subscribe, returns true if a new subscription to deliver
+func (ctx *Context) subscription(event *Event) bool {
+	ctx.Lock()
+	defer ctx.Unlock()
+	watch, ok := ctx.watchers[event.Dialog]
+	if !ok {
+		return true
+	}
+
+	// refresh or removal of an existing subscription
+	C.eXosip_insubscription_send_answer(ctx.context, C.int(event.Tran), C.int(SIP_OK), nil)
+	if event.Expires == 0 {
+		ctx.notify(watch.did, SUB_TERMINATED, C.DEACTIVATED, "", nil)
+		return false
+	}
+	if event.Expires < 0 {
+		event.Expires = subscribeExpires
+	}
+	watch.expires = time.Now().Add(time.Duration(event.Expires) * time.Second)
+	return false
+}
+
+// terminate expired inbound subscriptions
+func (ctx *Context) expire() {
+	now := time.Now()
+	ctx.Lock()
+	defer ctx.Unlock()
+	for did, watch := range ctx.watchers {
+		if now.After(watch.expires) {
+			ctx.notify(did, SUB_TERMINATED, C.TIMEOUT, "", nil)
+		}
+	}
+}
+
+// response to our notify, subscriber gone if failed
+func (ctx *Context) notified(evt *C.eXosip_event_t, status SIP_STATUS) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if status == SIP_UNAUTHORIZED || status == SIP_PROXY_AUTH_REQUIRED {
+		C.eXosip_default_action(ctx.context, evt)
+		return
+	}
+	if status >= 300 || status == SIP_UNKNOWN {
+		delete(ctx.watchers, int(evt.did))
+	}
+}
+
+// response to our subscribe, returns true if event should be delivered
+func (ctx *Context) subscribed(evt *C.eXosip_event_t, event *Event) bool {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if event.Status == SIP_UNAUTHORIZED || event.Status == SIP_PROXY_AUTH_REQUIRED {
+		C.eXosip_default_action(ctx.context, evt)
+		return false
+	}
+	if ctx.dropCancelled(event, event.Status >= 300) {
+		return false
+	}
+	if _, ok := ctx.subscriptions[event.Subscription]; !ok {
+		return false
+	}
+	if event.Status < 300 {
+		ctx.subscriptions[event.Subscription] = event.Dialog
+	} else {
+		delete(ctx.subscriptions, event.Subscription)
+	}
+	return true
+}
+
+// inbound notify for a client subscription, always answered
+func (ctx *Context) notification(event *Event, state string) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	C.eXosip_subscription_send_answer(ctx.context, C.int(event.Tran), C.int(SIP_OK), nil)
+	terminated := strings.HasPrefix(strings.ToLower(state), "terminated")
+	if ctx.dropCancelled(event, terminated) {
+		return
+	}
+	if _, ok := ctx.subscriptions[event.Subscription]; !ok {
+		return
+	}
+	if terminated {
+		delete(ctx.subscriptions, event.Subscription)
+		event.Expires = 0
+		return
+	}
+	ctx.subscriptions[event.Subscription] = event.Dialog
+}
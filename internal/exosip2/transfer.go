@@ -0,0 +1,159 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//go:build !nosip
+
+package exosip2
+
+/*
+#include <stdlib.h>
+#include <eXosip2/eXosip.h>
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// size of a refer-to built from a consultation dialog
+const referSize = 1024
+
+// Transfer a call dialog to a target with a blind refer
+func (ctx *Context) Transfer(did int, target string) error {
+	if did < 0 || len(target) < 1 {
+		return fmt.Errorf("invalid call transfer")
+	}
+
+	cs_target := C.CString(target)
+	defer C.free(unsafe.Pointer(cs_target))
+	ctx.Lock()
+	defer ctx.Unlock()
+	return ctx.refer(did, cs_target)
+}
+
+// AttendedTransfer refers a call dialog to the remote party of a
+// consultation dialog, which the transfer then replaces.
+func (ctx *Context) AttendedTransfer(did, consult int) error {
+	if did < 0 || consult < 0 {
+		return fmt.Errorf("invalid call transfer")
+	}
+
+	cs_target := (*C.char)(C.calloc(referSize, 1))
+	defer C.free(unsafe.Pointer(cs_target))
+	ctx.Lock()
+	defer ctx.Unlock()
+	result := int(C.eXosip_call_get_referto(ctx.context, C.int(consult), cs_target, referSize))
+	if result != 0 {
+		return fmt.Errorf("call transfer failed; code=%d", result)
+	}
+	return ctx.refer(did, cs_target)
+}
+
+// TransferStatus notifies the transferor of progress for a refer we
+// received, as a sipfrag.  A final status terminates the subscription.
+func (ctx *Context) TransferStatus(did int, status SIP_STATUS) error {
+	if did < 0 || status < 100 {
+		return fmt.Errorf("invalid transfer status")
+	}
+
+	state := C.int(C.EXOSIP_SUBCRSTATE_ACTIVE)
+	if status >= 200 {
+		state = C.int(C.EXOSIP_SUBCRSTATE_TERMINATED)
+	}
+	frag := fmt.Sprintf("SIP/2.0 %d %s\r\n", status, C.GoString(C.osip_message_get_reason(C.int(status))))
+	cs_event := C.CString("Event")
+	cs_refer := C.CString("refer")
+	defer C.free(unsafe.Pointer(cs_event))
+	defer C.free(unsafe.Pointer(cs_refer))
+
+	ctx.Lock()
+	defer ctx.Unlock()
+	var msg *C.osip_message_t
+	result := int(C.eXosip_call_build_notify(ctx.context, C.int(did), state, &msg))
+	if result != 0 {
+		return fmt.Errorf("transfer notify failed; code=%d", result)
+	}
+	C.osip_message_set_header(msg, cs_event, cs_refer)
+	setBody(msg, SIPFRAG_CONTENT+";version=2.0", []byte(frag))
+	result = int(C.eXosip_call_send_request(ctx.context, C.int(did), msg))
+	if result != 0 {
+		return fmt.Errorf("transfer notify failed; code=%d", result)
+	}
+	return nil
+}
+
+// Redirect a received request with 302 and a list of contacts to try
+func (ctx *Context) Redirect(event *Event, contacts ...string) error {
+	if len(contacts) < 1 {
+		return fmt.Errorf("no redirect contacts")
+	}
+
+	event.Status = SIP_MOVED_TEMPORARILY
+	ctx.Lock()
+	msg := ctx.makeReply(event)
+	if msg == nil {
+		ctx.Unlock()
+		return fmt.Errorf("redirect failed; no transaction")
+	}
+	for _, contact := range contacts {
+		cs_contact := C.CString(contact)
+		C.osip_message_set_contact(msg, cs_contact)
+		C.free(unsafe.Pointer(cs_contact))
+	}
+	ctx.Unlock()
+	ctx.sendReply(event, msg)
+	return nil
+}
+
+// send refer in a call dialog, with context locked
+func (ctx *Context) refer(did int, target *C.char) error {
+	var msg *C.osip_message_t
+	result := int(C.eXosip_call_build_refer(ctx.context, C.int(did), target, &msg))
+	if result != 0 {
+		return fmt.Errorf("call transfer failed; code=%d", result)
+	}
+	result = int(C.eXosip_call_send_request(ctx.context, C.int(did), msg))
+	if result != 0 {
+		return fmt.Errorf("call transfer failed; code=%d", result)
+	}
+	return nil
+}
+
+// inbound refer for a call dialog, replied to by the application
+func (ctx *Context) referred(event *Event) bool {
+	event.Target, event.Replaces = parseReferTo(event.Header("refer-to"))
+	if len(event.Target) < 1 {
+		event.Reply(SIP_BAD_REQUEST)
+		return false
+	}
+	return true
+}
+
+// sipfrag progress of a transfer we sent, with the fragment status
+func (ctx *Context) progress(event *Event) bool {
+	if !strings.HasPrefix(strings.ToLower(event.Header("event")), "refer") {
+		event.Reply(SIP_BAD_EVENT)
+		return false
+	}
+
+	status, err := parseSipfrag(event.Body)
+	if err != nil {
+		event.Reply(SIP_BAD_REQUEST)
+		return false
+	}
+	event.Reply(SIP_OK)
+	event.Status = status
+	return true
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const digits = "0123456789*#ABCD"
+
+// rfc 4733 telephone event
+type Event struct {
+	Digit     byte
+	Code      int
+	End       bool
+	Volume    int
+	Duration  int // in timestamp units
+	Timestamp uint32
+}
+
+// DecodeEvent from a telephone-event payload
+func DecodeEvent(data []byte) (Event, error) {
+	if len(data) < 4 {
+		return Event{}, fmt.Errorf("rtp invalid event")
+	}
+
+	event := Event{
+		Code:     int(data[0]),
+		End:      data[1]&0x80 != 0,
+		Volume:   int(data[1] & 0x3f),
+		Duration: int(binary.BigEndian.Uint16(data[2:])),
+	}
+	if event.Code < len(digits) {
+		event.Digit = digits[event.Code]
+	}
+	return event, nil
+}
+
+// Encode a telephone-event payload
+func (event *Event) Encode() []byte {
+	out := make([]byte, 4)
+	out[0] = byte(event.Code)
+	out[1] = byte(event.Volume & 0x3f)
+	if event.End {
+		out[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(out[2:], uint16(event.Duration))
+	return out
+}
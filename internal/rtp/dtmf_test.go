@@ -0,0 +1,46 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import "testing"
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		want  Event
+		fails bool
+	}{
+		{[]byte{5, 0x0a, 0x03, 0x20}, Event{Digit: '5', Code: 5, Volume: 10, Duration: 800}, false},
+		{[]byte{10, 0x8a, 0x06, 0x40}, Event{Digit: '*', Code: 10, End: true, Volume: 10, Duration: 1600}, false},
+		{[]byte{11, 0x80, 0, 0}, Event{Digit: '#', Code: 11, End: true}, false},
+		{[]byte{15, 0xbf, 0, 0}, Event{Digit: 'D', Code: 15, End: true, Volume: 63}, false},
+		{[]byte{16, 0, 0, 0}, Event{Code: 16}, false},
+		{[]byte{5, 0, 0}, Event{}, true},
+	}
+	for _, test := range tests {
+		event, err := DecodeEvent(test.data)
+		if (err != nil) != test.fails || event != test.want {
+			t.Errorf("%v: got %+v %v, want %+v", test.data, event, err, test.want)
+		}
+		if err != nil {
+			continue
+		}
+		again, _ := DecodeEvent(event.Encode())
+		if again != event {
+			t.Errorf("%v: encode round trip got %+v", test.data, again)
+		}
+	}
+}
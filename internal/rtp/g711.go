@@ -0,0 +1,140 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+// static payload types for g.711 audio
+const (
+	PCMU = 0
+	PCMA = 8
+)
+
+var (
+	ulawEnd = []int{0x3f, 0x7f, 0xff, 0x1ff, 0x3ff, 0x7ff, 0xfff, 0x1fff}
+	alawEnd = []int{0x1f, 0x3f, 0x7f, 0xff, 0x1ff, 0x3ff, 0x7ff, 0xfff}
+)
+
+func segment(value int, table []int) int {
+	for seg, end := range table {
+		if value <= end {
+			return seg
+		}
+	}
+	return len(table)
+}
+
+// EncodeUlaw converts a linear sample to mu-law
+func EncodeUlaw(sample int16) byte {
+	value := int(sample) >> 2
+	mask := 0xff
+	if value < 0 {
+		value = -value
+		mask = 0x7f
+	}
+	if value > 8159 {
+		value = 8159
+	}
+	value += 0x84 >> 2
+	seg := segment(value, ulawEnd)
+	if seg >= 8 {
+		return byte(0x7f ^ mask)
+	}
+	return byte(((seg << 4) | ((value >> (seg + 1)) & 0x0f)) ^ mask)
+}
+
+// DecodeUlaw converts a mu-law sample to linear
+func DecodeUlaw(code byte) int16 {
+	value := int(^code)
+	sample := ((value & 0x0f) << 3) + 0x84
+	sample <<= (value & 0x70) >> 4
+	if value&0x80 != 0 {
+		return int16(0x84 - sample)
+	}
+	return int16(sample - 0x84)
+}
+
+// EncodeAlaw converts a linear sample to a-law
+func EncodeAlaw(sample int16) byte {
+	value := int(sample) >> 3
+	mask := 0xd5
+	if value < 0 {
+		mask = 0x55
+		value = -value - 1
+	}
+	seg := segment(value, alawEnd)
+	if seg >= 8 {
+		return byte(0x7f ^ mask)
+	}
+	code := seg << 4
+	if seg < 2 {
+		code |= (value >> 1) & 0x0f
+	} else {
+		code |= (value >> seg) & 0x0f
+	}
+	return byte(code ^ mask)
+}
+
+// DecodeAlaw converts an a-law sample to linear
+func DecodeAlaw(code byte) int16 {
+	value := int(code ^ 0x55)
+	sample := (value & 0x0f) << 4
+	switch seg := (value & 0x70) >> 4; seg {
+	case 0:
+		sample += 8
+	case 1:
+		sample += 0x108
+	default:
+		sample += 0x108
+		sample <<= seg - 1
+	}
+	if value&0x80 != 0 {
+		return int16(sample)
+	}
+	return int16(-sample)
+}
+
+// Encode linear pcm audio for a g.711 payload type
+func Encode(payload int, pcm []int16) []byte {
+	out := make([]byte, len(pcm))
+	for pos, sample := range pcm {
+		if payload == PCMA {
+			out[pos] = EncodeAlaw(sample)
+		} else {
+			out[pos] = EncodeUlaw(sample)
+		}
+	}
+	return out
+}
+
+// Decode g.711 audio to linear pcm for a payload type
+func Decode(payload int, data []byte) []int16 {
+	out := make([]int16, len(data))
+	for pos, code := range data {
+		if payload == PCMA {
+			out[pos] = DecodeAlaw(code)
+		} else {
+			out[pos] = DecodeUlaw(code)
+		}
+	}
+	return out
+}
+
+// Silence is the encoded zero level for a payload type
+func Silence(payload int) byte {
+	if payload == PCMA {
+		return 0xd5
+	}
+	return 0xff
+}
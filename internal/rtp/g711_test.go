@@ -0,0 +1,67 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import "testing"
+
+func TestG711(t *testing.T) {
+	tests := []struct {
+		payload int
+		sample  int16
+		code    byte
+		decoded int16
+	}{
+		{PCMU, 0, 0xff, 0},
+		{PCMU, 32767, 0x80, 32124},
+		{PCMU, -32768, 0x00, -32124},
+		{PCMU, 1000, 0xce, 988},
+		{PCMA, 0, 0xd5, 8},
+		{PCMA, 32767, 0xaa, 32256},
+		{PCMA, -32768, 0x2a, -32256},
+		{PCMA, 1000, 0xfa, 1008},
+	}
+	for _, test := range tests {
+		code := Encode(test.payload, []int16{test.sample})[0]
+		if code != test.code {
+			t.Errorf("payload %d encode %d: got %#x, want %#x", test.payload, test.sample, code, test.code)
+		}
+		if decoded := Decode(test.payload, []byte{code})[0]; decoded != test.decoded {
+			t.Errorf("payload %d decode %#x: got %d, want %d", test.payload, code, decoded, test.decoded)
+		}
+	}
+}
+
+func TestG711RoundTrip(t *testing.T) {
+	for _, payload := range []int{PCMU, PCMA} {
+		for sample := -32768; sample < 32768; sample += 7 {
+			decoded := int(Decode(payload, Encode(payload, []int16{int16(sample)}))[0])
+			// quantization step grows with magnitude, about 1/16 at worst
+			if abs(decoded-sample) > 16+abs(sample)/16 {
+				t.Fatalf("payload %d sample %d decoded as %d", payload, sample, decoded)
+			}
+		}
+		if code := Encode(payload, []int16{0})[0]; code != Silence(payload) {
+			t.Errorf("payload %d silence %#x, want %#x", payload, Silence(payload), code)
+		}
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+// Jitter buffer reorders received packets and holds a minimum depth
+// before releasing them for playback.
+type Jitter struct {
+	depth   int
+	limit   int
+	frames  []Packet
+	next    uint16
+	started bool
+}
+
+func NewJitter(depth int) *Jitter {
+	if depth < 1 {
+		depth = 1
+	}
+	return &Jitter{depth: depth, limit: depth * 4}
+}
+
+// Push a received packet, dropping late and duplicate packets
+func (jitter *Jitter) Push(pkt Packet) {
+	if jitter.started && seqBefore(pkt.Sequence, jitter.next) {
+		return
+	}
+
+	pos := len(jitter.frames)
+	for pos > 0 && seqBefore(pkt.Sequence, jitter.frames[pos-1].Sequence) {
+		pos--
+	}
+	if pos > 0 && jitter.frames[pos-1].Sequence == pkt.Sequence {
+		return
+	}
+
+	jitter.frames = append(jitter.frames, Packet{})
+	copy(jitter.frames[pos+1:], jitter.frames[pos:])
+	jitter.frames[pos] = pkt
+
+	// overflow drops oldest frames
+	if len(jitter.frames) > jitter.limit {
+		jitter.frames = jitter.frames[len(jitter.frames)-jitter.limit:]
+	}
+}
+
+// Pop the next packet in sequence order once buffered to depth
+func (jitter *Jitter) Pop() (Packet, bool) {
+	if len(jitter.frames) < jitter.depth {
+		return Packet{}, false
+	}
+
+	return jitter.Drain()
+}
+
+// Drain the next packet regardless of depth, such as when input stops
+func (jitter *Jitter) Drain() (Packet, bool) {
+	if len(jitter.frames) < 1 {
+		return Packet{}, false
+	}
+
+	pkt := jitter.frames[0]
+	jitter.frames = jitter.frames[1:]
+	jitter.next = pkt.Sequence + 1
+	jitter.started = true
+	return pkt, true
+}
+
+// Len of buffered packets
+func (jitter *Jitter) Len() int {
+	return len(jitter.frames)
+}
+
+// Reset discards buffered packets, such as after a source change
+func (jitter *Jitter) Reset() {
+	jitter.frames = nil
+	jitter.started = false
+}
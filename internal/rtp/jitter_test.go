@@ -0,0 +1,100 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import "testing"
+
+func sequences(jitter *Jitter, drain bool) []uint16 {
+	var list []uint16
+	for {
+		pop := jitter.Pop
+		if drain {
+			pop = jitter.Drain
+		}
+		pkt, ok := pop()
+		if !ok {
+			return list
+		}
+		list = append(list, pkt.Sequence)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		depth  int
+		pushed []uint16
+		popped []uint16
+		held   int
+	}{
+		{"in order", 2, []uint16{1, 2, 3, 4}, []uint16{1, 2, 3}, 1},
+		{"reorder", 1, []uint16{3, 1, 2}, []uint16{1, 2, 3}, 0},
+		{"duplicate", 1, []uint16{1, 2, 2, 3}, []uint16{1, 2, 3}, 0},
+		{"below depth", 3, []uint16{1, 2}, nil, 2},
+		{"overflow drops oldest", 1, []uint16{1, 2, 3, 4, 5, 6}, []uint16{3, 4, 5, 6}, 0},
+		{"wrap", 1, []uint16{65535, 0, 1}, []uint16{65535, 0, 1}, 0},
+	}
+	for _, test := range tests {
+		jitter := NewJitter(test.depth)
+		if test.name == "overflow drops oldest" {
+			jitter.limit = 4
+		}
+		for _, seq := range test.pushed {
+			jitter.Push(Packet{Sequence: seq})
+		}
+		popped := sequences(jitter, false)
+		if len(popped) != len(test.popped) || jitter.Len() != test.held {
+			t.Errorf("%s: popped %v holding %d, want %v holding %d", test.name, popped, jitter.Len(), test.popped, test.held)
+			continue
+		}
+		for pos := range popped {
+			if popped[pos] != test.popped[pos] {
+				t.Errorf("%s: popped %v, want %v", test.name, popped, test.popped)
+				break
+			}
+		}
+	}
+}
+
+func TestJitterLate(t *testing.T) {
+	jitter := NewJitter(1)
+	jitter.Push(Packet{Sequence: 10})
+	jitter.Push(Packet{Sequence: 11})
+	sequences(jitter, false)
+	jitter.Push(Packet{Sequence: 9})
+	jitter.Push(Packet{Sequence: 11})
+	if jitter.Len() != 0 {
+		t.Fatalf("late packets buffered, holding %d", jitter.Len())
+	}
+}
+
+func TestJitterDrain(t *testing.T) {
+	jitter := NewJitter(3)
+	jitter.Push(Packet{Sequence: 2})
+	jitter.Push(Packet{Sequence: 1})
+	if _, ok := jitter.Pop(); ok {
+		t.Fatal("popped below depth")
+	}
+	drained := sequences(jitter, true)
+	if len(drained) != 2 || drained[0] != 1 || drained[1] != 2 {
+		t.Fatalf("drained %v", drained)
+	}
+	jitter.Push(Packet{Sequence: 3})
+	jitter.Reset()
+	if jitter.Len() != 0 {
+		t.Fatal("reset kept packets")
+	}
+}
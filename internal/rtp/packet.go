@@ -0,0 +1,82 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const headerSize = 12
+
+type Packet struct {
+	Marker    bool
+	Payload   int
+	Sequence  uint16
+	Timestamp uint32
+	Ssrc      uint32
+	Data      []byte
+}
+
+// Marshal an rtp packet for sending
+func (pkt *Packet) Marshal() []byte {
+	out := make([]byte, headerSize+len(pkt.Data))
+	out[0] = 0x80
+	out[1] = byte(pkt.Payload & 0x7f)
+	if pkt.Marker {
+		out[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(out[2:], pkt.Sequence)
+	binary.BigEndian.PutUint32(out[4:], pkt.Timestamp)
+	binary.BigEndian.PutUint32(out[8:], pkt.Ssrc)
+	copy(out[headerSize:], pkt.Data)
+	return out
+}
+
+// Unmarshal a received rtp packet, skipping csrc and extension headers
+func (pkt *Packet) Unmarshal(data []byte) error {
+	if len(data) < headerSize || data[0]>>6 != 2 {
+		return fmt.Errorf("rtp invalid packet")
+	}
+
+	end := len(data)
+	if data[0]&0x20 != 0 {
+		end -= int(data[end-1])
+	}
+	offset := headerSize + int(data[0]&0x0f)*4
+	if data[0]&0x10 != 0 {
+		if offset+4 > end {
+			return fmt.Errorf("rtp invalid extension")
+		}
+		offset += 4 + int(binary.BigEndian.Uint16(data[offset+2:]))*4
+	}
+	if offset > end {
+		return fmt.Errorf("rtp invalid header")
+	}
+
+	pkt.Marker = data[1]&0x80 != 0
+	pkt.Payload = int(data[1] & 0x7f)
+	pkt.Sequence = binary.BigEndian.Uint16(data[2:])
+	pkt.Timestamp = binary.BigEndian.Uint32(data[4:])
+	pkt.Ssrc = binary.BigEndian.Uint32(data[8:])
+	pkt.Data = append([]byte(nil), data[offset:end]...)
+	return nil
+}
+
+// is sequence a before b, allowing for wrap
+func seqBefore(a, b uint16) bool {
+	return int16(a-b) < 0
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacket(t *testing.T) {
+	sent := Packet{Marker: true, Payload: PCMA, Sequence: 65535, Timestamp: 0xdeadbeef, Ssrc: 42, Data: []byte{1, 2, 3}}
+	var pkt Packet
+	if err := pkt.Unmarshal(sent.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if pkt.Marker != sent.Marker || pkt.Payload != sent.Payload || pkt.Sequence != sent.Sequence || pkt.Timestamp != sent.Timestamp || pkt.Ssrc != sent.Ssrc || !bytes.Equal(pkt.Data, sent.Data) {
+		t.Fatalf("got %+v, want %+v", pkt, sent)
+	}
+}
+
+func TestPacketUnmarshal(t *testing.T) {
+	header := []byte{0x80, 0x00, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}
+	with := func(first byte, rest ...byte) []byte {
+		data := append([]byte{first}, header[1:]...)
+		return append(data, rest...)
+	}
+	tests := []struct {
+		name  string
+		data  []byte
+		want  []byte
+		fails bool
+	}{
+		{"plain", with(0x80, 9, 9), []byte{9, 9}, false},
+		{"padding", with(0xa0, 9, 9, 0, 0, 3), []byte{9, 9}, false},
+		{"csrc", with(0x81, 0, 0, 0, 7, 9), []byte{9}, false},
+		{"extension", with(0x90, 0xbe, 0xde, 0, 1, 1, 2, 3, 4, 9), []byte{9}, false},
+		{"csrc and extension", with(0x91, 0, 0, 0, 7, 0xbe, 0xde, 0, 0, 9), []byte{9}, false},
+		{"short", header[:8], nil, true},
+		{"version", with(0x40, 9), nil, true},
+		{"truncated csrc", with(0x82, 0, 0, 0, 7), nil, true},
+		{"truncated extension", with(0x90, 0xbe, 0xde, 0, 2, 1, 2, 3, 4), nil, true},
+		{"padding past header", with(0xa0, 9, 40), nil, true},
+	}
+	for _, test := range tests {
+		var pkt Packet
+		err := pkt.Unmarshal(test.data)
+		if (err != nil) != test.fails {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if !test.fails && !bytes.Equal(pkt.Data, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, pkt.Data, test.want)
+		}
+	}
+}
+
+func TestSeqBefore(t *testing.T) {
+	tests := []struct {
+		a, b uint16
+		want bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{2, 2, false},
+		{65535, 0, true},
+		{0, 65535, false},
+	}
+	for _, test := range tests {
+		if got := seqBefore(test.a, test.b); got != test.want {
+			t.Errorf("seqBefore(%d, %d) = %v", test.a, test.b, got)
+		}
+	}
+}
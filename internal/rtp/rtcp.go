@@ -0,0 +1,220 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	RTCP_SR   = 200
+	RTCP_RR   = 201
+	RTCP_SDES = 202
+	RTCP_BYE  = 203
+)
+
+// sdes canonical name item
+const sdesCname = 1
+
+// rtcp report block
+type Report struct {
+	Ssrc     uint32
+	Fraction uint8
+	Lost     uint32
+	Highest  uint32
+	Jitter   uint32
+	Lsr      uint32
+	Dlsr     uint32
+}
+
+// parsed rtcp sender, receiver, source description, or bye packet
+type Control struct {
+	Type      int
+	Ssrc      uint32
+	Cname     string
+	Ntp       uint64
+	Timestamp uint32
+	Packets   uint32
+	Octets    uint32
+	Reports   []Report
+}
+
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func ntpTime(now time.Time) uint64 {
+	offset := now.Sub(ntpEpoch)
+	secs := uint64(offset / time.Second)
+	frac := uint64(offset%time.Second) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// middle 32 bits of ntp time, used for lsr and rtt
+func ntpMiddle(ntp uint64) uint32 {
+	return uint32(ntp >> 16)
+}
+
+func controlHeader(out []byte, count, kind int) {
+	out[0] = 0x80 | byte(count&0x1f)
+	out[1] = byte(kind)
+	binary.BigEndian.PutUint16(out[2:], uint16(len(out)/4-1))
+}
+
+func putReports(out []byte, reports []Report) {
+	for _, report := range reports {
+		binary.BigEndian.PutUint32(out[0:], report.Ssrc)
+		binary.BigEndian.PutUint32(out[4:], uint32(report.Fraction)<<24|report.Lost&0xffffff)
+		binary.BigEndian.PutUint32(out[8:], report.Highest)
+		binary.BigEndian.PutUint32(out[12:], report.Jitter)
+		binary.BigEndian.PutUint32(out[16:], report.Lsr)
+		binary.BigEndian.PutUint32(out[20:], report.Dlsr)
+		out = out[24:]
+	}
+}
+
+// Marshal a sender or receiver report, source description, or a bye
+func (ctrl *Control) Marshal() []byte {
+	var out []byte
+	switch ctrl.Type {
+	case RTCP_SR:
+		out = make([]byte, 28+len(ctrl.Reports)*24)
+		binary.BigEndian.PutUint32(out[4:], ctrl.Ssrc)
+		binary.BigEndian.PutUint64(out[8:], ctrl.Ntp)
+		binary.BigEndian.PutUint32(out[16:], ctrl.Timestamp)
+		binary.BigEndian.PutUint32(out[20:], ctrl.Packets)
+		binary.BigEndian.PutUint32(out[24:], ctrl.Octets)
+		putReports(out[28:], ctrl.Reports)
+		controlHeader(out, len(ctrl.Reports), RTCP_SR)
+	case RTCP_RR:
+		out = make([]byte, 8+len(ctrl.Reports)*24)
+		binary.BigEndian.PutUint32(out[4:], ctrl.Ssrc)
+		putReports(out[8:], ctrl.Reports)
+		controlHeader(out, len(ctrl.Reports), RTCP_RR)
+	case RTCP_SDES:
+		// single chunk with cname item, null terminated and padded
+		name := ctrl.Cname
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		out = make([]byte, (8+2+len(name)+1+3)&^3)
+		binary.BigEndian.PutUint32(out[4:], ctrl.Ssrc)
+		out[8] = sdesCname
+		out[9] = byte(len(name))
+		copy(out[10:], name)
+		controlHeader(out, 1, RTCP_SDES)
+	case RTCP_BYE:
+		out = make([]byte, 8)
+		binary.BigEndian.PutUint32(out[4:], ctrl.Ssrc)
+		controlHeader(out, 1, RTCP_BYE)
+	}
+	return out
+}
+
+// Compound joins rtcp packets into a single compound packet
+func Compound(list ...Control) []byte {
+	var out []byte
+	for _, ctrl := range list {
+		out = append(out, ctrl.Marshal()...)
+	}
+	return out
+}
+
+// cname of the first sdes chunk, if present
+func getCname(data []byte, count int) (uint32, string) {
+	if count < 1 || len(data) < 4 {
+		return 0, ""
+	}
+	ssrc := binary.BigEndian.Uint32(data)
+	items := data[4:]
+	for len(items) >= 2 && items[0] != 0 {
+		size := int(items[1])
+		if 2+size > len(items) {
+			break
+		}
+		if items[0] == sdesCname {
+			return ssrc, string(items[2 : 2+size])
+		}
+		items = items[2+size:]
+	}
+	return ssrc, ""
+}
+
+func getReports(data []byte, count int) []Report {
+	var reports []Report
+	for count > 0 && len(data) >= 24 {
+		lost := binary.BigEndian.Uint32(data[4:])
+		reports = append(reports, Report{
+			Ssrc:     binary.BigEndian.Uint32(data[0:]),
+			Fraction: uint8(lost >> 24),
+			Lost:     lost & 0xffffff,
+			Highest:  binary.BigEndian.Uint32(data[8:]),
+			Jitter:   binary.BigEndian.Uint32(data[12:]),
+			Lsr:      binary.BigEndian.Uint32(data[16:]),
+			Dlsr:     binary.BigEndian.Uint32(data[20:]),
+		})
+		data = data[24:]
+		count--
+	}
+	return reports
+}
+
+// ParseControl parses a compound rtcp packet, skipping unknown types
+func ParseControl(data []byte) ([]Control, error) {
+	var list []Control
+	for len(data) >= 4 {
+		if data[0]>>6 != 2 {
+			return list, fmt.Errorf("rtcp invalid packet")
+		}
+		size := (int(binary.BigEndian.Uint16(data[2:])) + 1) * 4
+		if size > len(data) {
+			return list, fmt.Errorf("rtcp truncated packet")
+		}
+
+		body := data[:size]
+		count := int(data[0] & 0x1f)
+		switch int(data[1]) {
+		case RTCP_SR:
+			if size < 28 {
+				break
+			}
+			list = append(list, Control{
+				Type:      RTCP_SR,
+				Ssrc:      binary.BigEndian.Uint32(body[4:]),
+				Ntp:       binary.BigEndian.Uint64(body[8:]),
+				Timestamp: binary.BigEndian.Uint32(body[16:]),
+				Packets:   binary.BigEndian.Uint32(body[20:]),
+				Octets:    binary.BigEndian.Uint32(body[24:]),
+				Reports:   getReports(body[28:], count),
+			})
+		case RTCP_RR:
+			if size < 8 {
+				break
+			}
+			list = append(list, Control{Type: RTCP_RR, Ssrc: binary.BigEndian.Uint32(body[4:]), Reports: getReports(body[8:], count)})
+		case RTCP_SDES:
+			ssrc, cname := getCname(body[4:], count)
+			list = append(list, Control{Type: RTCP_SDES, Ssrc: ssrc, Cname: cname})
+		case RTCP_BYE:
+			if size < 8 {
+				break
+			}
+			list = append(list, Control{Type: RTCP_BYE, Ssrc: binary.BigEndian.Uint32(body[4:])})
+		}
+		data = data[size:]
+	}
+	return list, nil
+}
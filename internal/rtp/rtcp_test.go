@@ -0,0 +1,71 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestControl(t *testing.T) {
+	report := Report{Ssrc: 7, Fraction: 64, Lost: 3, Highest: 70000, Jitter: 12, Lsr: 0x12345678, Dlsr: 655}
+	tests := []Control{
+		{Type: RTCP_SR, Ssrc: 1, Ntp: ntpTime(time.Unix(1700000000, 0)), Timestamp: 8000, Packets: 50, Octets: 8000, Reports: []Report{report}},
+		{Type: RTCP_SR, Ssrc: 1, Ntp: 1 << 40, Timestamp: 1},
+		{Type: RTCP_RR, Ssrc: 2, Reports: []Report{report, report}},
+		{Type: RTCP_RR, Ssrc: 2},
+		{Type: RTCP_SDES, Ssrc: 3, Cname: "netmouth@example.com"},
+		{Type: RTCP_SDES, Ssrc: 3, Cname: "abc"},
+		{Type: RTCP_BYE, Ssrc: 4},
+	}
+	for _, sent := range tests {
+		data := sent.Marshal()
+		if len(data)%4 != 0 {
+			t.Errorf("type %d: length %d not aligned", sent.Type, len(data))
+		}
+		list, err := ParseControl(data)
+		if err != nil || len(list) != 1 {
+			t.Errorf("type %d: got %v %v", sent.Type, list, err)
+			continue
+		}
+		got := list[0]
+		if got.Type != sent.Type || got.Ssrc != sent.Ssrc || got.Ntp != sent.Ntp || got.Timestamp != sent.Timestamp || got.Packets != sent.Packets || got.Octets != sent.Octets || got.Cname != sent.Cname || len(got.Reports) != len(sent.Reports) {
+			t.Errorf("type %d: got %+v, want %+v", sent.Type, got, sent)
+			continue
+		}
+		for pos := range got.Reports {
+			if got.Reports[pos] != sent.Reports[pos] {
+				t.Errorf("type %d: report %+v, want %+v", sent.Type, got.Reports[pos], sent.Reports[pos])
+			}
+		}
+	}
+}
+
+func TestCompound(t *testing.T) {
+	data := Compound(Control{Type: RTCP_RR, Ssrc: 1}, Control{Type: RTCP_SDES, Ssrc: 1, Cname: "cname"}, Control{Type: RTCP_BYE, Ssrc: 1})
+	data = append(data, 0x80, 204, 0, 0) // unknown app packet is skipped
+	list, err := ParseControl(data)
+	if err != nil || len(list) != 3 || list[0].Type != RTCP_RR || list[1].Cname != "cname" || list[2].Type != RTCP_BYE {
+		t.Fatalf("got %+v %v", list, err)
+	}
+
+	if _, err := ParseControl([]byte{0x40, 200, 0, 0}); err == nil {
+		t.Error("expected version error")
+	}
+	if _, err := ParseControl([]byte{0x80, 200, 0, 6, 0, 0, 0, 0}); err == nil {
+		t.Error("expected truncated error")
+	}
+}
@@ -0,0 +1,498 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Host    string // local interface to bind
+	Port    int    // even rtp port, or 0 to pick one
+	Payload int    // PCMU or PCMA
+	Dtmf    int    // telephone-event payload, 0 for 101, -1 to disable
+	Ptime   int    // frame size in ms
+	Depth   int    // jitter buffer depth in frames
+	Cname   string // rtcp canonical name, random if empty
+}
+
+// receive statistics per rfc 3550
+type Stats struct {
+	Sent     uint32
+	Octets   uint32
+	Received uint32
+	Lost     uint32
+	Jitter   uint32
+	Rtt      time.Duration
+}
+
+type Session struct {
+	Config
+	data    *net.UDPConn
+	control *net.UDPConn
+	remote  *net.UDPAddr
+	report  *net.UDPAddr
+	closed  chan bool
+	closing sync.Once
+	active  sync.WaitGroup
+	lock    sync.Mutex
+	jitter  *Jitter
+	events  chan Event
+	pending []int16
+
+	// sending state
+	ssrc    uint32
+	seq     uint16
+	stamp   uint32
+	next    time.Time
+	marker  bool
+	packets uint32
+	octets  uint32
+
+	// receive state
+	source   uint32
+	base     uint16
+	max      uint16
+	cycles   uint32
+	received uint32
+	expected uint32 // expected prior for reports
+	prior    uint32 // received prior for reports
+	transit  int64
+	estimate float64
+	epoch    time.Time
+	digit    uint32 // timestamp of last reported event
+	lsr      uint32
+	lsrTime  time.Time
+	rtt      time.Duration
+	heard    time.Time // arrival of last audio packet
+}
+
+const rate = 8000
+
+func random32() uint32 {
+	var buf [4]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return uint32(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint32(buf[:])
+}
+
+// bind an even rtp port and the rtcp port above it
+func listenPair(host string, port int) (*net.UDPConn, *net.UDPConn, error) {
+	for tries := 0; tries < 64; tries++ {
+		data, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(host), Port: port})
+		if err != nil {
+			return nil, nil, err
+		}
+		local := data.LocalAddr().(*net.UDPAddr).Port
+		if local&0x01 != 0 {
+			data.Close()
+			if port != 0 {
+				return nil, nil, fmt.Errorf("rtp port must be even")
+			}
+			continue
+		}
+		control, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(host), Port: local + 1})
+		if err != nil {
+			data.Close()
+			if port != 0 {
+				return nil, nil, err
+			}
+			continue
+		}
+		return data, control, nil
+	}
+	return nil, nil, fmt.Errorf("rtp no ports available")
+}
+
+// New creates an rtp session bound to local ports
+func New(config Config) (*Session, error) {
+	if config.Payload != PCMA {
+		config.Payload = PCMU
+	}
+	if config.Dtmf == 0 {
+		config.Dtmf = 101
+	}
+	if config.Ptime < 10 {
+		config.Ptime = 20
+	}
+	if config.Depth < 1 {
+		config.Depth = 3
+	}
+	if len(config.Cname) < 1 {
+		config.Cname = fmt.Sprintf("%08x%08x", random32(), random32())
+	}
+
+	data, control, err := listenPair(config.Host, config.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		Config:  config,
+		data:    data,
+		control: control,
+		closed:  make(chan bool),
+		jitter:  NewJitter(config.Depth),
+		events:  make(chan Event, 16),
+		ssrc:    random32(),
+		seq:     uint16(random32()),
+		stamp:   random32(),
+		marker:  true,
+		epoch:   time.Now(),
+	}
+	session.Port = data.LocalAddr().(*net.UDPAddr).Port
+	session.active.Add(3)
+	go session.receiver()
+	go session.controller()
+	go session.reporter()
+	return session, nil
+}
+
+// Connect sets the remote rtp address, usually from sdp
+func (s *Session) Connect(host string, port int) error {
+	remote, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remote = remote
+	s.report = &net.UDPAddr{IP: remote.IP, Port: remote.Port + 1, Zone: remote.Zone}
+	return nil
+}
+
+// SetPayload changes the g.711 encoding, such as from an sdp answer
+func (s *Session) SetPayload(payload int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if payload != PCMA {
+		payload = PCMU
+	}
+	s.Payload = payload
+}
+
+// Samples per frame
+func (s *Session) Samples() int {
+	return rate * s.Ptime / 1000
+}
+
+// Events delivers decoded rfc 4733 telephone events
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+// Write linear pcm audio at 8khz, sent as paced g.711 frames
+func (s *Session) Write(pcm []int16) error {
+	s.pending = append(s.pending, pcm...)
+	samples := s.Samples()
+	for len(s.pending) >= samples {
+		err := s.send(s.pending[:samples])
+		if err != nil {
+			return err
+		}
+		s.pending = s.pending[samples:]
+	}
+	return nil
+}
+
+// Flush pads and sends any partial frame
+func (s *Session) Flush() error {
+	if len(s.pending) < 1 {
+		return nil
+	}
+	pad := make([]int16, s.Samples()-len(s.pending))
+	return s.Write(pad)
+}
+
+func (s *Session) send(pcm []int16) error {
+	s.lock.Lock()
+	wait := s.pace(time.Now())
+	s.lock.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.remote == nil {
+		return fmt.Errorf("rtp not connected")
+	}
+	pkt := Packet{Marker: s.marker, Payload: s.Payload, Sequence: s.seq, Timestamp: s.stamp, Ssrc: s.ssrc, Data: Encode(s.Payload, pcm)}
+	_, err := s.data.WriteToUDP(pkt.Marshal(), s.remote)
+	s.marker = false
+	s.seq++
+	s.stamp += uint32(len(pcm))
+	s.packets++
+	s.octets += uint32(len(pkt.Data))
+	return err
+}
+
+// schedule the next frame, returns how long to wait before sending it
+func (s *Session) pace(now time.Time) time.Duration {
+	frame := time.Duration(s.Ptime) * time.Millisecond
+	if s.next.IsZero() || now.Sub(s.next) > frame*5 {
+		// start of a new talkspurt
+		if !s.next.IsZero() {
+			s.stamp += uint32(now.Sub(s.next) * rate / time.Second)
+		}
+		s.next = now
+		s.marker = true
+	}
+	wait := s.next.Sub(now)
+	s.next = s.next.Add(frame)
+	return wait
+}
+
+// Read the next received audio frame from the jitter buffer
+func (s *Session) Read() ([]int16, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pkt, ok := s.jitter.Pop()
+	if !ok && s.jitter.Len() > 0 && time.Since(s.heard) > time.Duration(s.Depth*s.Ptime)*time.Millisecond {
+		// input stopped, release what remains below depth
+		pkt, ok = s.jitter.Drain()
+	}
+	if !ok {
+		return nil, false
+	}
+	return Decode(pkt.Payload, pkt.Data), true
+}
+
+// Stats for the session
+func (s *Session) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, lost, _ := s.losses()
+	return Stats{
+		Sent:     s.packets,
+		Octets:   s.octets,
+		Received: s.received,
+		Lost:     lost,
+		Jitter:   uint32(s.estimate),
+		Rtt:      s.rtt,
+	}
+}
+
+// Close the session, sending rtcp bye
+func (s *Session) Close() {
+	s.closing.Do(func() {
+		s.lock.Lock()
+		if s.report != nil {
+			s.control.WriteToUDP(Compound(s.receiverReport(), s.describe(), Control{Type: RTCP_BYE, Ssrc: s.ssrc}), s.report)
+		}
+		s.lock.Unlock()
+		close(s.closed)
+		s.data.Close()
+		s.control.Close()
+		s.active.Wait()
+		close(s.events)
+	})
+}
+
+func (s *Session) receiver() {
+	defer s.active.Done()
+	buf := make([]byte, 2048)
+	for {
+		size, from, err := s.data.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		var pkt Packet
+		if pkt.Unmarshal(buf[:size]) != nil {
+			continue
+		}
+
+		s.lock.Lock()
+		if s.remote == nil {
+			// symmetric rtp when no remote set yet
+			s.remote = from
+			s.report = &net.UDPAddr{IP: from.IP, Port: from.Port + 1, Zone: from.Zone}
+		}
+		if s.Dtmf > 0 && pkt.Payload == s.Dtmf {
+			s.event(&pkt)
+		} else if pkt.Payload == s.Payload {
+			s.heard = time.Now()
+			s.update(&pkt, s.heard)
+			s.jitter.Push(pkt)
+		}
+		s.lock.Unlock()
+	}
+}
+
+// report telephone event once, at the end of the event
+func (s *Session) event(pkt *Packet) {
+	event, err := DecodeEvent(pkt.Data)
+	if err != nil || !event.End || (s.digit == pkt.Timestamp && s.digit != 0) {
+		return
+	}
+	s.digit = pkt.Timestamp
+	event.Timestamp = pkt.Timestamp
+	select {
+	case s.events <- event:
+	default:
+	}
+}
+
+// update receive statistics and interarrival jitter
+func (s *Session) update(pkt *Packet, arrival time.Time) {
+	if s.received == 0 || pkt.Ssrc != s.source {
+		s.source = pkt.Ssrc
+		s.base = pkt.Sequence
+		s.max = pkt.Sequence
+		s.cycles = 0
+		s.received = 0
+		s.expected = 0
+		s.prior = 0
+		s.transit = 0
+		s.jitter.Reset()
+	} else if seqBefore(s.max, pkt.Sequence) {
+		if pkt.Sequence < s.max {
+			s.cycles += 1 << 16
+		}
+		s.max = pkt.Sequence
+	}
+	s.received++
+
+	stamp := int64(arrival.Sub(s.epoch) * rate / time.Second)
+	transit := stamp - int64(pkt.Timestamp)
+	if s.transit != 0 {
+		delta := transit - s.transit
+		if delta < 0 {
+			delta = -delta
+		}
+		s.estimate += (float64(delta) - s.estimate) / 16
+	}
+	s.transit = transit
+}
+
+func (s *Session) losses() (uint32, uint32, uint32) {
+	if s.received == 0 {
+		return 0, 0, 0
+	}
+	highest := s.cycles + uint32(s.max)
+	expected := highest - uint32(s.base) + 1
+	lost := uint32(0)
+	if expected > s.received {
+		lost = expected - s.received
+	}
+	return highest, lost, expected
+}
+
+func (s *Session) reports() []Report {
+	highest, lost, expected := s.losses()
+	if expected == 0 {
+		return nil
+	}
+
+	interval := expected - s.expected
+	received := s.received - s.prior
+	s.expected = expected
+	s.prior = s.received
+	fraction := uint8(0)
+	if interval > received {
+		fraction = uint8(((interval - received) << 8) / interval)
+	}
+
+	dlsr := uint32(0)
+	if s.lsr != 0 {
+		dlsr = uint32(time.Since(s.lsrTime) * 65536 / time.Second)
+	}
+	return []Report{{
+		Ssrc:     s.source,
+		Fraction: fraction,
+		Lost:     lost,
+		Highest:  highest,
+		Jitter:   uint32(s.estimate),
+		Lsr:      s.lsr,
+		Dlsr:     dlsr,
+	}}
+}
+
+// receiver report of the remote source
+func (s *Session) receiverReport() Control {
+	return Control{Type: RTCP_RR, Ssrc: s.ssrc, Reports: s.reports()}
+}
+
+// source description required in every compound packet (rfc 3550 6.1)
+func (s *Session) describe() Control {
+	return Control{Type: RTCP_SDES, Ssrc: s.ssrc, Cname: s.Cname}
+}
+
+// periodically send sender or receiver reports
+func (s *Session) reporter() {
+	defer s.active.Done()
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case now := <-ticker.C:
+			s.lock.Lock()
+			if s.report != nil {
+				ctrl := s.receiverReport()
+				if s.packets > 0 {
+					ctrl.Type = RTCP_SR
+					ctrl.Ntp = ntpTime(now)
+					ctrl.Timestamp = s.stamp
+					ctrl.Packets = s.packets
+					ctrl.Octets = s.octets
+				}
+				s.control.WriteToUDP(Compound(ctrl, s.describe()), s.report)
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+// receive rtcp reports for lsr and round trip time
+func (s *Session) controller() {
+	defer s.active.Done()
+	buf := make([]byte, 2048)
+	for {
+		size, _, err := s.control.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		list, _ := ParseControl(buf[:size])
+		now := time.Now()
+		s.lock.Lock()
+		for _, ctrl := range list {
+			if ctrl.Type == RTCP_SR {
+				s.lsr = ntpMiddle(ctrl.Ntp)
+				s.lsrTime = now
+			}
+			for _, report := range ctrl.Reports {
+				if report.Ssrc != s.ssrc || report.Lsr == 0 {
+					continue
+				}
+				delay := ntpMiddle(ntpTime(now)) - report.Lsr - report.Dlsr
+				s.rtt = time.Duration(delay) * time.Second / 65536
+			}
+		}
+		s.lock.Unlock()
+	}
+}
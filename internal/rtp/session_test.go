@@ -0,0 +1,110 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rtp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSessionLoopback(t *testing.T) {
+	sender, err := New(Config{Host: "127.0.0.1", Payload: PCMA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	receiver, err := New(Config{Host: "127.0.0.1", Payload: PCMA, Depth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	if sender.Port%2 != 0 || receiver.Port%2 != 0 {
+		t.Fatalf("odd rtp ports %d %d", sender.Port, receiver.Port)
+	}
+	if err := sender.Connect("127.0.0.1", receiver.Port); err != nil {
+		t.Fatal(err)
+	}
+
+	// two frames stay below jitter depth, and drain once input stops
+	pcm := make([]int16, sender.Samples()*2)
+	for pos := range pcm {
+		pcm[pos] = 1000
+	}
+	if err := sender.Write(pcm); err != nil {
+		t.Fatal(err)
+	}
+	frames := 0
+	deadline := time.Now().Add(2 * time.Second)
+	for frames < 2 && time.Now().Before(deadline) {
+		frame, ok := receiver.Read()
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if len(frame) != receiver.Samples() || frame[0] != 1008 {
+			t.Fatalf("frame of %d samples starting %d", len(frame), frame[0])
+		}
+		frames++
+	}
+	if frames != 2 {
+		t.Fatalf("received %d frames", frames)
+	}
+
+	stats := sender.Stats()
+	if stats.Sent != 2 || stats.Octets != uint32(len(pcm)) {
+		t.Errorf("sender stats %+v", stats)
+	}
+	if stats := receiver.Stats(); stats.Received != 2 || stats.Lost != 0 {
+		t.Errorf("receiver stats %+v", stats)
+	}
+
+	sender.Close()
+	sender.Close()
+}
+
+func TestSessionEvents(t *testing.T) {
+	receiver, err := New(Config{Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	sender, err := New(Config{Host: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	// repeated end packets report the digit once
+	event := Event{Code: 9, End: true, Duration: 800}
+	for count := 0; count < 3; count++ {
+		pkt := Packet{Payload: 101, Sequence: uint16(count), Timestamp: 160, Ssrc: 1, Data: event.Encode()}
+		sender.data.WriteToUDP(pkt.Marshal(), receiver.data.LocalAddr().(*net.UDPAddr))
+	}
+	select {
+	case got := <-receiver.Events():
+		if got.Digit != '9' {
+			t.Fatalf("got digit %c", got.Digit)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no telephone event")
+	}
+	select {
+	case got := <-receiver.Events():
+		t.Fatalf("repeated digit %c", got.Digit)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sdp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewOrigin creates a local origin for a given address
+func NewOrigin(user, address string) Origin {
+	if len(user) < 1 {
+		user = "-"
+	}
+	id := uint64(time.Now().Unix())
+	return Origin{Username: user, SessionId: id, Version: id, NetType: "IN", AddrType: addrType(address), Address: address}
+}
+
+func addrType(address string) string {
+	ip := net.ParseIP(address)
+	if ip != nil && ip.To4() == nil {
+		return "IP6"
+	}
+	return "IP4"
+}
+
+// Matches if codecs are the same encoding
+func (codec Codec) Matches(other Codec) bool {
+	return strings.EqualFold(codec.Name, other.Name) && codec.Rate == other.Rate
+}
+
+// IsEvent if telephone events codec
+func (codec Codec) IsEvent() bool {
+	return strings.EqualFold(codec.Name, DTMF.Name)
+}
+
+// Reverse direction for answering
+func (dir Direction) Reverse() Direction {
+	switch dir {
+	case SENDONLY:
+		return RECVONLY
+	case RECVONLY:
+		return SENDONLY
+	case INACTIVE:
+		return INACTIVE
+	}
+	return SENDRECV
+}
+
+// Negotiate picks the first local codec in order of preference that is
+// also offered by the remote, using the remote payload type.
+func Negotiate(media *Media, local []Codec) (Codec, error) {
+	if media == nil {
+		return Codec{}, fmt.Errorf("sdp no media offered")
+	}
+
+	for _, codec := range local {
+		if codec.IsEvent() {
+			continue
+		}
+		for _, remote := range media.Codecs {
+			if codec.Matches(remote) {
+				return remote, nil
+			}
+		}
+	}
+	return Codec{}, fmt.Errorf("sdp no common codec")
+}
+
+// Events finds offered telephone events if supported locally
+func Events(media *Media, local []Codec) (Codec, bool) {
+	if media == nil {
+		return Codec{}, false
+	}
+
+	for _, codec := range local {
+		if !codec.IsEvent() {
+			continue
+		}
+		for _, remote := range media.Codecs {
+			if codec.Matches(remote) {
+				return remote, true
+			}
+		}
+	}
+	return Codec{}, false
+}
+
+// Offer creates a new audio offer from local codecs
+func Offer(origin Origin, address string, port int, local []Codec) *Session {
+	return &Session{
+		Origin:     origin,
+		Name:       "-",
+		Connection: &Connection{NetType: "IN", AddrType: addrType(address), Address: address},
+		Direction:  SENDRECV,
+		Media: []Media{{
+			Type:      "audio",
+			Port:      port,
+			Proto:     "RTP/AVP",
+			Codecs:    append([]Codec(nil), local...),
+			Ptime:     20,
+			Direction: SENDRECV,
+		}},
+	}
+}
+
+// Answer an offer with the negotiated codec and optional telephone events.
+// Every offered stream is answered in order, and streams other than the
+// negotiated audio are rejected with a zero port (rfc 3264 section 6).
+func (offer *Session) Answer(origin Origin, address string, port int, local []Codec) (*Session, error) {
+	media := offer.Audio()
+	codec, err := Negotiate(media, local)
+	if err != nil {
+		return nil, err
+	}
+
+	codecs := []Codec{codec}
+	if events, ok := Events(media, local); ok {
+		codecs = append(codecs, events)
+	}
+
+	answer := Offer(origin, address, port, codecs)
+	audio := answer.Media[0]
+	audio.Direction = media.Direction.Reverse()
+	if media.Ptime > 0 {
+		audio.Ptime = media.Ptime
+	}
+
+	answer.Media = make([]Media, 0, len(offer.Media))
+	for pos := range offer.Media {
+		if &offer.Media[pos] == media {
+			answer.Media = append(answer.Media, audio)
+			continue
+		}
+		offered := &offer.Media[pos]
+		formats := offered.Formats
+		if len(formats) < 1 {
+			for _, codec := range offered.Codecs {
+				formats = append(formats, strconv.Itoa(codec.Payload))
+			}
+		}
+		answer.Media = append(answer.Media, Media{Type: offered.Type, Port: 0, Proto: offered.Proto, Formats: formats})
+	}
+	return answer, nil
+}
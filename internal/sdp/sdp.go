@@ -0,0 +1,394 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sdp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const ContentType = "application/sdp"
+
+type Direction string
+
+const (
+	SENDRECV Direction = "sendrecv"
+	SENDONLY Direction = "sendonly"
+	RECVONLY Direction = "recvonly"
+	INACTIVE Direction = "inactive"
+)
+
+type Origin struct {
+	Username  string
+	SessionId uint64
+	Version   uint64
+	NetType   string
+	AddrType  string
+	Address   string
+}
+
+type Connection struct {
+	NetType  string
+	AddrType string
+	Address  string
+}
+
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+type Codec struct {
+	Payload  int
+	Name     string
+	Rate     int
+	Channels int
+	Fmtp     string
+}
+
+type Media struct {
+	Type       string
+	Port       int
+	Proto      string
+	Formats    []string
+	Codecs     []Codec
+	Connection *Connection
+	Ptime      int
+	Direction  Direction
+	Attributes []Attribute
+}
+
+type Session struct {
+	Version    int
+	Origin     Origin
+	Name       string
+	Connection *Connection
+	Start      uint64
+	Stop       uint64
+	Direction  Direction
+	Attributes []Attribute
+	Media      []Media
+}
+
+// well known static payload types
+var static = map[int]Codec{
+	0:  {Payload: 0, Name: "PCMU", Rate: 8000, Channels: 1},
+	3:  {Payload: 3, Name: "GSM", Rate: 8000, Channels: 1},
+	4:  {Payload: 4, Name: "G723", Rate: 8000, Channels: 1},
+	8:  {Payload: 8, Name: "PCMA", Rate: 8000, Channels: 1},
+	9:  {Payload: 9, Name: "G722", Rate: 8000, Channels: 1},
+	18: {Payload: 18, Name: "G729", Rate: 8000, Channels: 1},
+}
+
+var (
+	PCMU  = static[0]
+	PCMA  = static[8]
+	DTMF  = Codec{Payload: 101, Name: "telephone-event", Rate: 8000, Channels: 1, Fmtp: "0-15"}
+	G711  = []Codec{PCMU, PCMA}
+	Audio = []Codec{PCMU, PCMA, DTMF}
+)
+
+// Parse a session description
+func Parse(data []byte) (*Session, error) {
+	session := &Session{Direction: SENDRECV}
+	var media *Media = nil
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) < 1 {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, fmt.Errorf("sdp invalid line: %s", line)
+		}
+
+		value := line[2:]
+		switch line[0] {
+		case 'v':
+			version, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("sdp invalid version: %s", value)
+			}
+			session.Version = version
+		case 'o':
+			origin, err := parseOrigin(value)
+			if err != nil {
+				return nil, err
+			}
+			session.Origin = origin
+		case 's':
+			session.Name = value
+		case 'c':
+			connect, err := parseConnection(value)
+			if err != nil {
+				return nil, err
+			}
+			if media != nil {
+				media.Connection = connect
+			} else {
+				session.Connection = connect
+			}
+		case 't':
+			fields := strings.Fields(value)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("sdp invalid time: %s", value)
+			}
+			session.Start, _ = strconv.ParseUint(fields[0], 10, 64)
+			session.Stop, _ = strconv.ParseUint(fields[1], 10, 64)
+		case 'm':
+			current, err := parseMedia(value)
+			if err != nil {
+				return nil, err
+			}
+			current.Direction = session.Direction
+			session.Media = append(session.Media, current)
+			media = &session.Media[len(session.Media)-1]
+		case 'a':
+			key, val := value, ""
+			if pos := strings.IndexByte(value, ':'); pos > -1 {
+				key, val = value[:pos], value[pos+1:]
+			}
+			if media != nil {
+				media.attribute(key, val)
+				continue
+			}
+			switch Direction(key) {
+			case SENDRECV, SENDONLY, RECVONLY, INACTIVE:
+				session.Direction = Direction(key)
+			default:
+				session.Attributes = append(session.Attributes, Attribute{Key: key, Value: val})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(session.Origin.Address) < 1 {
+		return nil, fmt.Errorf("sdp missing origin")
+	}
+	return session, nil
+}
+
+func parseOrigin(value string) (Origin, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 6 {
+		return Origin{}, fmt.Errorf("sdp invalid origin: %s", value)
+	}
+	id, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return Origin{}, fmt.Errorf("sdp invalid origin: %s", value)
+	}
+	version, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return Origin{}, fmt.Errorf("sdp invalid origin: %s", value)
+	}
+	return Origin{Username: fields[0], SessionId: id, Version: version, NetType: fields[3], AddrType: fields[4], Address: fields[5]}, nil
+}
+
+func parseConnection(value string) (*Connection, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("sdp invalid connection: %s", value)
+	}
+
+	// strip ttl and count from multicast addresses
+	address := fields[2]
+	if pos := strings.IndexByte(address, '/'); pos > -1 {
+		address = address[:pos]
+	}
+	return &Connection{NetType: fields[0], AddrType: fields[1], Address: address}, nil
+}
+
+func parseMedia(value string) (Media, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return Media{}, fmt.Errorf("sdp invalid media: %s", value)
+	}
+
+	port := fields[1]
+	if pos := strings.IndexByte(port, '/'); pos > -1 {
+		port = port[:pos]
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return Media{}, fmt.Errorf("sdp invalid media port: %s", value)
+	}
+
+	media := Media{Type: fields[0], Port: number, Proto: fields[2], Formats: fields[3:]}
+	for _, format := range fields[3:] {
+		payload, err := strconv.Atoi(format)
+		if err != nil {
+			continue // non-rtp formats
+		}
+		if codec, ok := static[payload]; ok {
+			media.Codecs = append(media.Codecs, codec)
+		} else {
+			media.Codecs = append(media.Codecs, Codec{Payload: payload, Channels: 1})
+		}
+	}
+	return media, nil
+}
+
+func (media *Media) attribute(key, value string) {
+	switch key {
+	case "sendrecv", "sendonly", "recvonly", "inactive":
+		media.Direction = Direction(key)
+	case "ptime":
+		media.Ptime, _ = strconv.Atoi(value)
+	case "rtpmap":
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			break
+		}
+		payload, err := strconv.Atoi(fields[0])
+		if err != nil {
+			break
+		}
+		codec := media.Codec(payload)
+		if codec == nil {
+			break
+		}
+		parts := strings.Split(fields[1], "/")
+		codec.Name = parts[0]
+		if len(parts) > 1 {
+			codec.Rate, _ = strconv.Atoi(parts[1])
+		}
+		if len(parts) > 2 {
+			codec.Channels, _ = strconv.Atoi(parts[2])
+		}
+	case "fmtp":
+		pos := strings.IndexByte(value, ' ')
+		if pos < 0 {
+			break
+		}
+		payload, err := strconv.Atoi(value[:pos])
+		if err != nil {
+			break
+		}
+		if codec := media.Codec(payload); codec != nil {
+			codec.Fmtp = strings.TrimSpace(value[pos+1:])
+		}
+	default:
+		media.Attributes = append(media.Attributes, Attribute{Key: key, Value: value})
+	}
+}
+
+// Codec finds the codec of a media payload type
+func (media *Media) Codec(payload int) *Codec {
+	for pos := range media.Codecs {
+		if media.Codecs[pos].Payload == payload {
+			return &media.Codecs[pos]
+		}
+	}
+	return nil
+}
+
+// Address of the media stream, from media or session connection
+func (session *Session) Address(media *Media) string {
+	if media != nil && media.Connection != nil {
+		return media.Connection.Address
+	}
+	if session.Connection != nil {
+		return session.Connection.Address
+	}
+	return ""
+}
+
+// Audio finds the first active audio stream
+func (session *Session) Audio() *Media {
+	for pos := range session.Media {
+		media := &session.Media[pos]
+		if media.Type == "audio" && media.Port > 0 {
+			return media
+		}
+	}
+	return nil
+}
+
+// Marshal a session description for sending
+func (session *Session) Marshal() []byte {
+	var out bytes.Buffer
+	origin := session.Origin
+	fmt.Fprintf(&out, "v=%d\r\n", session.Version)
+	fmt.Fprintf(&out, "o=%s %d %d %s %s %s\r\n", origin.Username, origin.SessionId, origin.Version, origin.NetType, origin.AddrType, origin.Address)
+	name := session.Name
+	if len(name) < 1 {
+		name = "-"
+	}
+	fmt.Fprintf(&out, "s=%s\r\n", name)
+	writeConnection(&out, session.Connection)
+	fmt.Fprintf(&out, "t=%d %d\r\n", session.Start, session.Stop)
+	if len(session.Direction) > 0 && session.Direction != SENDRECV {
+		fmt.Fprintf(&out, "a=%s\r\n", session.Direction)
+	}
+	writeAttributes(&out, session.Attributes)
+	for _, media := range session.Media {
+		formats := media.Formats
+		if len(media.Codecs) > 0 {
+			formats = make([]string, 0, len(media.Codecs))
+			for _, codec := range media.Codecs {
+				formats = append(formats, strconv.Itoa(codec.Payload))
+			}
+		}
+		fmt.Fprintf(&out, "m=%s %d %s %s\r\n", media.Type, media.Port, media.Proto, strings.Join(formats, " "))
+		writeConnection(&out, media.Connection)
+		for _, codec := range media.Codecs {
+			if len(codec.Name) > 0 {
+				if codec.Channels > 1 {
+					fmt.Fprintf(&out, "a=rtpmap:%d %s/%d/%d\r\n", codec.Payload, codec.Name, codec.Rate, codec.Channels)
+				} else {
+					fmt.Fprintf(&out, "a=rtpmap:%d %s/%d\r\n", codec.Payload, codec.Name, codec.Rate)
+				}
+			}
+			if len(codec.Fmtp) > 0 {
+				fmt.Fprintf(&out, "a=fmtp:%d %s\r\n", codec.Payload, codec.Fmtp)
+			}
+		}
+		if media.Ptime > 0 {
+			fmt.Fprintf(&out, "a=ptime:%d\r\n", media.Ptime)
+		}
+		if len(media.Direction) > 0 {
+			fmt.Fprintf(&out, "a=%s\r\n", media.Direction)
+		}
+		writeAttributes(&out, media.Attributes)
+	}
+	return out.Bytes()
+}
+
+func (session *Session) String() string {
+	return string(session.Marshal())
+}
+
+func writeConnection(out *bytes.Buffer, connect *Connection) {
+	if connect != nil {
+		fmt.Fprintf(out, "c=%s %s %s\r\n", connect.NetType, connect.AddrType, connect.Address)
+	}
+}
+
+func writeAttributes(out *bytes.Buffer, attributes []Attribute) {
+	for _, attr := range attributes {
+		if len(attr.Value) > 0 {
+			fmt.Fprintf(out, "a=%s:%s\r\n", attr.Key, attr.Value)
+		} else {
+			fmt.Fprintf(out, "a=%s\r\n", attr.Key)
+		}
+	}
+}
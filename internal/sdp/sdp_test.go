@@ -0,0 +1,145 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sdp
+
+import "testing"
+
+const offer = "v=0\r\n" +
+	"o=alice 2890844526 2890844526 IN IP4 10.0.0.1\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 10.0.0.1\r\n" +
+	"t=0 0\r\n" +
+	"m=video 5002 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"m=audio 5000 RTP/AVP 8 0 101\r\n" +
+	"a=rtpmap:101 telephone-event/8000\r\n" +
+	"a=fmtp:101 0-15\r\n" +
+	"a=ptime:30\r\n" +
+	"a=sendonly\r\n" +
+	"m=image 5004 udptl t38\r\n"
+
+func TestParse(t *testing.T) {
+	session, err := Parse([]byte(offer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Origin.Username != "alice" || session.Origin.Address != "10.0.0.1" {
+		t.Errorf("origin %+v", session.Origin)
+	}
+	if len(session.Media) != 3 {
+		t.Fatalf("got %d media streams", len(session.Media))
+	}
+	audio := session.Audio()
+	if audio == nil || audio.Port != 5000 || audio.Ptime != 30 || audio.Direction != SENDONLY {
+		t.Fatalf("audio %+v", audio)
+	}
+	if session.Address(audio) != "10.0.0.1" {
+		t.Errorf("address %s", session.Address(audio))
+	}
+	if codec := audio.Codec(101); codec == nil || !codec.IsEvent() || codec.Fmtp != "0-15" {
+		t.Errorf("telephone events %+v", codec)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"v=0\r\ns=-\r\n",
+		"v=x\r\no=- 1 1 IN IP4 10.0.0.1\r\n",
+		"v=0\r\no=- 1 IN IP4 10.0.0.1\r\n",
+		"v=0\r\no=- 1 1 IN IP4 10.0.0.1\r\nm=audio x RTP/AVP 0\r\n",
+		"v=0\r\no=- 1 1 IN IP4 10.0.0.1\r\nbad\r\n",
+	}
+	for _, text := range tests {
+		if _, err := Parse([]byte(text)); err == nil {
+			t.Errorf("%q: expected error", text)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		offered []Codec
+		local   []Codec
+		want    string
+		events  bool
+		fails   bool
+	}{
+		{[]Codec{PCMA, PCMU}, G711, "PCMU", false, false},
+		{[]Codec{PCMA, DTMF}, Audio, "PCMA", true, false},
+		{[]Codec{static[18]}, Audio, "", false, true},
+		{[]Codec{DTMF}, Audio, "", true, true},
+	}
+	for _, test := range tests {
+		media := &Media{Type: "audio", Port: 5000, Codecs: test.offered}
+		codec, err := Negotiate(media, test.local)
+		if (err != nil) != test.fails || codec.Name != test.want {
+			t.Errorf("%v: got %s %v, want %s", test.offered, codec.Name, err, test.want)
+		}
+		if _, ok := Events(media, test.local); ok != test.events {
+			t.Errorf("%v: events %v, want %v", test.offered, ok, test.events)
+		}
+	}
+	if _, err := Negotiate(nil, Audio); err == nil {
+		t.Error("expected error without media")
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	session, err := Parse([]byte(offer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := session.Answer(NewOrigin("bob", "10.0.0.2"), "10.0.0.2", 6000, Audio)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// round trip the answer to check what is on the wire
+	answer, err = Parse(answer.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		kind    string
+		port    int
+		formats []string
+	}{
+		{"video", 0, []string{"96"}},
+		{"audio", 6000, []string{"0", "101"}},
+		{"image", 0, []string{"t38"}},
+	}
+	if len(answer.Media) != len(tests) {
+		t.Fatalf("got %d media streams, want %d", len(answer.Media), len(tests))
+	}
+	for pos, test := range tests {
+		media := answer.Media[pos]
+		if media.Type != test.kind || media.Port != test.port || len(media.Formats) != len(test.formats) {
+			t.Errorf("stream %d: got %s %d %v", pos, media.Type, media.Port, media.Formats)
+			continue
+		}
+		for index, format := range test.formats {
+			if media.Formats[index] != format {
+				t.Errorf("stream %d: got formats %v, want %v", pos, media.Formats, test.formats)
+				break
+			}
+		}
+	}
+
+	audio := answer.Audio()
+	if audio.Direction != RECVONLY || audio.Ptime != 30 {
+		t.Errorf("audio direction %s ptime %d", audio.Direction, audio.Ptime)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stun
+
+import (
+	"net"
+)
+
+// Server answers stun binding requests, such as for local testing
+type Server struct {
+	conn *net.UDPConn
+}
+
+// NewServer binds a stun responder, port 0 picks a free port
+func NewServer(address string) (*Server, error) {
+	local, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{conn: conn}, nil
+}
+
+func (server *Server) Addr() string {
+	return server.conn.LocalAddr().String()
+}
+
+// Serve binding requests until closed
+func (server *Server) Serve() error {
+	buffer := make([]byte, 1500)
+	for {
+		size, from, err := server.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return err
+		}
+		request, err := parse(buffer[:size])
+		if err != nil || request.kind != bindingRequest {
+			continue
+		}
+		reply := &message{kind: bindingResponse, id: request.id, address: from}
+		server.conn.WriteToUDP(reply.marshal(), from)
+	}
+}
+
+func (server *Server) Close() error {
+	return server.conn.Close()
+}
@@ -0,0 +1,211 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stun
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	headerSize = 20
+	cookie     = 0x2112a442
+
+	bindingRequest  = 0x0001
+	bindingResponse = 0x0101
+
+	attrMapped    = 0x0001
+	attrXorMapped = 0x0020
+
+	defaultPort = "3478"
+)
+
+// binding request or response message
+type message struct {
+	kind    uint16
+	id      [12]byte
+	address *net.UDPAddr
+}
+
+func (msg *message) marshal() []byte {
+	var attrs []byte
+	if msg.address != nil {
+		attrs = xorAddress(msg.address, msg.id)
+	}
+
+	out := make([]byte, headerSize, headerSize+len(attrs))
+	binary.BigEndian.PutUint16(out[0:], msg.kind)
+	binary.BigEndian.PutUint16(out[2:], uint16(len(attrs)))
+	binary.BigEndian.PutUint32(out[4:], cookie)
+	copy(out[8:], msg.id[:])
+	return append(out, attrs...)
+}
+
+func parse(data []byte) (*message, error) {
+	if len(data) < headerSize || data[0]&0xc0 != 0 {
+		return nil, fmt.Errorf("stun message invalid")
+	}
+	if binary.BigEndian.Uint32(data[4:]) != cookie {
+		return nil, fmt.Errorf("stun cookie invalid")
+	}
+	size := int(binary.BigEndian.Uint16(data[2:]))
+	if headerSize+size > len(data) {
+		return nil, fmt.Errorf("stun message truncated")
+	}
+
+	msg := &message{kind: binary.BigEndian.Uint16(data[0:])}
+	copy(msg.id[:], data[8:20])
+	attrs := data[headerSize : headerSize+size]
+	for len(attrs) >= 4 {
+		kind := binary.BigEndian.Uint16(attrs[0:])
+		length := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+length > len(attrs) {
+			break
+		}
+		value := attrs[4 : 4+length]
+		switch kind {
+		case attrXorMapped:
+			msg.address = parseAddress(value, true, msg.id)
+		case attrMapped:
+			if msg.address == nil {
+				msg.address = parseAddress(value, false, msg.id)
+			}
+		}
+		// last attribute may be sent without padding
+		next := 4 + (length+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	return msg, nil
+}
+
+// xor-mapped-address attribute for a response
+func xorAddress(addr *net.UDPAddr, id [12]byte) []byte {
+	family, ip := byte(1), addr.IP.To4()
+	if ip == nil {
+		family, ip = 2, addr.IP.To16()
+	}
+
+	mask := make([]byte, 16)
+	binary.BigEndian.PutUint32(mask, cookie)
+	copy(mask[4:], id[:])
+	out := make([]byte, 8+len(ip))
+	binary.BigEndian.PutUint16(out[0:], attrXorMapped)
+	binary.BigEndian.PutUint16(out[2:], uint16(4+len(ip)))
+	out[5] = family
+	binary.BigEndian.PutUint16(out[6:], uint16(addr.Port)^uint16(cookie>>16))
+	for pos := range ip {
+		out[8+pos] = ip[pos] ^ mask[pos]
+	}
+	return out
+}
+
+func parseAddress(value []byte, xor bool, id [12]byte) *net.UDPAddr {
+	if len(value) < 8 {
+		return nil
+	}
+
+	size := 4
+	if value[1] == 2 {
+		size = 16
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+
+	port := binary.BigEndian.Uint16(value[2:])
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if xor {
+		mask := make([]byte, 16)
+		binary.BigEndian.PutUint32(mask, cookie)
+		copy(mask[4:], id[:])
+		port ^= uint16(cookie >> 16)
+		for pos := range ip {
+			ip[pos] ^= mask[pos]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}
+}
+
+// Lookup the public address of a new local udp socket thru a stun server
+func Lookup(server string, timeout time.Duration) (*net.UDPAddr, error) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return LookupConn(conn, server, timeout)
+}
+
+// LookupConn finds the public address of an existing udp socket, with
+// retransmission of the binding request until the timeout.  The server
+// port defaults to 3478 if not given.
+func LookupConn(conn *net.UDPConn, server string, timeout time.Duration) (*net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), defaultPort)
+	}
+	remote, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &message{kind: bindingRequest}
+	if _, err = rand.Read(request.id[:]); err != nil {
+		return nil, err
+	}
+
+	data := request.marshal()
+	buffer := make([]byte, 1500)
+	deadline := time.Now().Add(timeout)
+	retry := 250 * time.Millisecond
+	for time.Now().Before(deadline) {
+		if _, err = conn.WriteToUDP(data, remote); err != nil {
+			return nil, err
+		}
+
+		wait := time.Now().Add(retry)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+		for {
+			size, _, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				break
+			}
+			msg, err := parse(buffer[:size])
+			if err != nil || msg.kind != bindingResponse || !bytes.Equal(msg.id[:], request.id[:]) {
+				continue
+			}
+			conn.SetReadDeadline(time.Time{})
+			if msg.address == nil {
+				return nil, fmt.Errorf("stun response missing address")
+			}
+			return msg.address, nil
+		}
+		retry *= 2
+	}
+	conn.SetReadDeadline(time.Time{})
+	return nil, fmt.Errorf("stun lookup %s timed out", server)
+}
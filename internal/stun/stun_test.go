@@ -0,0 +1,118 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stun
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	id := [12]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	tests := []*net.UDPAddr{
+		nil,
+		{IP: net.ParseIP("192.0.2.1").To4(), Port: 32853},
+		{IP: net.ParseIP("2001:db8::1"), Port: 5060},
+	}
+	for _, address := range tests {
+		sent := &message{kind: bindingResponse, id: id, address: address}
+		msg, err := parse(sent.marshal())
+		if err != nil {
+			t.Errorf("%v: %v", address, err)
+			continue
+		}
+		if msg.kind != bindingResponse || msg.id != id {
+			t.Errorf("%v: header mismatch", address)
+		}
+		if address == nil {
+			if msg.address != nil {
+				t.Errorf("unexpected address %v", msg.address)
+			}
+			continue
+		}
+		if msg.address == nil || !msg.address.IP.Equal(address.IP) || msg.address.Port != address.Port {
+			t.Errorf("%v: got %v", address, msg.address)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	valid := (&message{kind: bindingRequest}).marshal()
+	badCookie := append([]byte(nil), valid...)
+	badCookie[4] = 0
+	truncated := append([]byte(nil), valid...)
+	truncated[3] = 8
+	tests := [][]byte{
+		nil,
+		valid[:headerSize-1],
+		{0xc0, 1, 0, 0, 0x21, 0x12, 0xa4, 0x42, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		badCookie,
+		truncated,
+	}
+	for _, data := range tests {
+		if _, err := parse(data); err == nil {
+			t.Errorf("%x: expected error", data)
+		}
+	}
+}
+
+func TestParseUnpadded(t *testing.T) {
+	// response with a final one byte attribute sent without padding
+	data := (&message{kind: bindingResponse}).marshal()
+	data = append(data, 0x80, 0x22, 0, 1, 'x')
+	data[3] = 5
+	msg, err := parse(data)
+	if err != nil || msg.address != nil {
+		t.Fatalf("got %v %v", msg, err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	server, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	address, err := LookupConn(conn, server.Addr(), 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := conn.LocalAddr().(*net.UDPAddr)
+	if !address.IP.Equal(local.IP) || address.Port != local.Port {
+		t.Errorf("got %v, want %v", address, local)
+	}
+}
+
+func TestDefaultPort(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = LookupConn(conn, "127.0.0.1", 100*time.Millisecond)
+	if err == nil || strings.Contains(err.Error(), "missing port") {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// Audio is decoded mono 16 bit speech
+type Audio struct {
+	Rate    int
+	Samples []int16
+}
+
+// Decode a wav or mp3 speech file
+func Decode(fileName string) (*Audio, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE" {
+		return decodeWav(data[12:])
+	}
+	return decodeMp3(data)
+}
+
+func decodeMp3(data []byte) (*Audio, error) {
+	decoder, err := mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// decoder output is always 16 bit stereo
+	pcm, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, err
+	}
+	return mix(pcm, 2, decoder.SampleRate()), nil
+}
+
+func decodeWav(data []byte) (*Audio, error) {
+	channels, rate := 0, 0
+	for len(data) >= 8 {
+		id, size := string(data[0:4]), int(binary.LittleEndian.Uint32(data[4:8]))
+		data = data[8:]
+		if size < 0 || size > len(data) {
+			size = len(data)
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("invalid wav format")
+			}
+			format := binary.LittleEndian.Uint16(data[0:])
+			bits := binary.LittleEndian.Uint16(data[14:])
+			if (format != 1 && format != 0xfffe) || bits != 16 {
+				return nil, fmt.Errorf("unsupported wav format %d; bits=%d", format, bits)
+			}
+			channels = int(binary.LittleEndian.Uint16(data[2:]))
+			rate = int(binary.LittleEndian.Uint32(data[4:]))
+		case "data":
+			if channels < 1 || rate < 1 {
+				return nil, fmt.Errorf("wav data before format")
+			}
+			return mix(data[:size], channels, rate), nil
+		}
+		if size += size % 2; size > len(data) {
+			size = len(data)
+		}
+		data = data[size:]
+	}
+	return nil, fmt.Errorf("no wav data")
+}
+
+// mix interleaved 16 bit little endian pcm to mono
+func mix(pcm []byte, channels, rate int) *Audio {
+	frames := len(pcm) / (channels * 2)
+	audio := &Audio{Rate: rate, Samples: make([]int16, frames)}
+	for frame := 0; frame < frames; frame++ {
+		sum := 0
+		for channel := 0; channel < channels; channel++ {
+			sum += int(int16(binary.LittleEndian.Uint16(pcm[(frame*channels+channel)*2:])))
+		}
+		audio.Samples[frame] = int16(sum / channels)
+	}
+	return audio
+}
+
+// Resample audio to another rate, averaging over each step to reduce
+// aliasing when down sampling
+func (audio *Audio) Resample(rate int) []int16 {
+	if rate == audio.Rate || len(audio.Samples) < 1 {
+		return audio.Samples
+	}
+
+	frames := len(audio.Samples)
+	step := float64(audio.Rate) / float64(rate)
+	out := make([]int16, 0, int(float64(frames)/step)+1)
+	for pos := 0.0; int(pos) < frames; pos += step {
+		start, end := int(pos), int(pos+step)
+		if end > frames {
+			end = frames
+		}
+		if end <= start {
+			end = start + 1
+		}
+		sum := 0
+		for frame := start; frame < end; frame++ {
+			sum += int(audio.Samples[frame])
+		}
+		out = append(out, int16(sum/(end-start)))
+	}
+	return out
+}
+
+// Gain scales samples by a volume level, 1 for unchanged
+func Gain(samples []int16, level float64) []int16 {
+	if level == 1 || level < 0 {
+		return samples
+	}
+	out := make([]int16, len(samples))
+	for pos, sample := range samples {
+		value := float64(sample) * level
+		if value > 32767 {
+			value = 32767
+		} else if value < -32768 {
+			value = -32768
+		}
+		out[pos] = int16(value)
+	}
+	return out
+}
+
+// WriteWav saves audio as a 16 bit mono wav file
+func WriteWav(fileName string, audio *Audio) error {
+	size := len(audio.Samples) * 2
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(36+size))
+	out.WriteString("WAVEfmt ")
+	binary.Write(&out, binary.LittleEndian, []uint32{16})
+	binary.Write(&out, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(&out, binary.LittleEndian, []uint32{uint32(audio.Rate), uint32(audio.Rate * 2)})
+	binary.Write(&out, binary.LittleEndian, []uint16{2, 16})
+	out.WriteString("data")
+	binary.Write(&out, binary.LittleEndian, uint32(size))
+	binary.Write(&out, binary.LittleEndian, audio.Samples)
+	return os.WriteFile(fileName, out.Bytes(), 0660)
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tts
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWavRoundTrip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.wav")
+	audio := &Audio{Rate: 16000, Samples: []int16{0, 1000, -1000, 32767, -32768, 42}}
+	if err := WriteWav(fileName, audio); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Rate != audio.Rate || len(decoded.Samples) != len(audio.Samples) {
+		t.Fatalf("got rate %d with %d samples", decoded.Rate, len(decoded.Samples))
+	}
+	for pos, sample := range audio.Samples {
+		if decoded.Samples[pos] != sample {
+			t.Fatalf("sample %d: got %d, want %d", pos, decoded.Samples[pos], sample)
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	audio := &Audio{Rate: 16000, Samples: []int16{100, 300, 500, 700, 900, 1100}}
+	if got := audio.Resample(16000); len(got) != 6 {
+		t.Fatalf("same rate changed samples: %v", got)
+	}
+	want := []int16{200, 600, 1000}
+	got := audio.Resample(8000)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for pos := range want {
+		if got[pos] != want[pos] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if got := (&Audio{Rate: 8000, Samples: []int16{1, 2}}).Resample(16000); len(got) != 4 {
+		t.Fatalf("upsample got %v", got)
+	}
+}
+
+func TestDecodeWav(t *testing.T) {
+	chunk := func(id string, body []byte, size uint32) []byte {
+		out := append([]byte(id), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(out[4:], size)
+		return append(out, body...)
+	}
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:], 1)
+	binary.LittleEndian.PutUint16(format[2:], 2)
+	binary.LittleEndian.PutUint32(format[4:], 8000)
+	binary.LittleEndian.PutUint16(format[14:], 16)
+	stereo := []byte{0x10, 0, 0x30, 0, 0xf0, 0xff, 0x10, 0}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"stereo", append(append(chunk("fmt ", format, 16), chunk("LIST", []byte{1, 2, 3, 0}, 3)...), chunk("data", stereo, 8)...), true},
+		{"odd final chunk", append(chunk("fmt ", format, 16), chunk("junk", []byte{1, 2, 3}, 3)...), false},
+		{"oversized chunk", chunk("fmt ", format, 1000), false},
+		{"data before format", chunk("data", stereo, 8), false},
+		{"short format", chunk("fmt ", format[:8], 8), false},
+	}
+	for _, test := range tests {
+		audio, err := decodeWav(test.data)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.valid && (audio.Rate != 8000 || len(audio.Samples) != 2 || audio.Samples[0] != 0x20 || audio.Samples[1] != 0) {
+			t.Errorf("%s: got %+v", test.name, audio)
+		}
+	}
+}
+
+func TestToneCache(t *testing.T) {
+	config := Config{Engine: "tone", Folder: t.TempDir(), Language: "en"}
+	engine, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName, err := engine.Synthesize("hello", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := Decode(fileName)
+	if err != nil || audio.Rate != toneRate || len(audio.Samples) != toneRate/2 {
+		t.Fatalf("tone audio invalid: %v", err)
+	}
+	again, err := engine.Synthesize("hello", Options{})
+	if err != nil || again != fileName {
+		t.Fatalf("not cached: %s, %v", again, err)
+	}
+	files, _ := os.ReadDir(config.Folder)
+	if len(files) != 1 {
+		t.Fatalf("got %d files in cache", len(files))
+	}
+}
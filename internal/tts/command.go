@@ -0,0 +1,114 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// longest a local synthesizer may run
+const synthesizeTimeout = time.Minute
+
+// local synthesizer program writing wav files
+type command struct {
+	config Config
+	path   string
+	stdin  bool
+	args   func(fileName, text string, options Options) []string
+}
+
+func newEspeak(config Config) *command {
+	return &command{config: config, path: program(config, "espeak-ng"), stdin: true, args: func(fileName, text string, options Options) []string {
+		voice := options.Voice
+		if len(voice) < 1 {
+			voice = options.Language
+		}
+		wpm := strconv.Itoa(int(175 * options.Speed))
+		return []string{"-v", voice, "-s", wpm, "-w", fileName, "--stdin"}
+	}}
+}
+
+func newPiper(config Config) (*command, error) {
+	if len(config.Model) < 1 {
+		return nil, fmt.Errorf("piper requires a voice model")
+	}
+	return &command{config: config, path: program(config, "piper"), stdin: true, args: func(fileName, text string, options Options) []string {
+		scale := strconv.FormatFloat(1/options.Speed, 'f', 2, 64)
+		return []string{"--model", options.Model, "--length_scale", scale, "--output_file", fileName}
+	}}, nil
+}
+
+func newFlite(config Config) *command {
+	return &command{config: config, path: program(config, "flite"), args: func(fileName, text string, options Options) []string {
+		stretch := strconv.FormatFloat(1/options.Speed, 'f', 2, 64)
+		args := []string{"-t", text, "-o", fileName, "--setf", "duration_stretch=" + stretch}
+		if len(options.Voice) > 0 {
+			args = append(args, "-voice", options.Voice)
+		}
+		return args
+	}}
+}
+
+func program(config Config, name string) string {
+	if len(config.Command) > 0 {
+		return config.Command
+	}
+	return name
+}
+
+func (engine *command) Synthesize(text string, options Options) (string, error) {
+	options = engine.config.options(options)
+	fileName := engine.config.cached(text, options, ".wav")
+	if exists(fileName) {
+		return fileName, nil
+	}
+
+	if err := os.MkdirAll(engine.config.Folder, 0770); err != nil {
+		return "", err
+	}
+	tempName, err := temporary(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), synthesizeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, engine.path, engine.args(tempName, text, options)...)
+	if engine.stdin {
+		cmd.Stdin = strings.NewReader(text)
+	}
+	output, err := cmd.CombinedOutput()
+	if err == nil && !exists(tempName) {
+		err = fmt.Errorf("no output")
+	}
+	if err != nil {
+		if detail := strings.TrimSpace(string(output)); len(detail) > 0 {
+			err = fmt.Errorf("%v; %s", err, detail)
+		}
+		return "", fmt.Errorf("%s failed; %v", engine.path, err)
+	}
+	if err := os.Rename(tempName, fileName); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
@@ -0,0 +1,44 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tts
+
+import (
+	"os"
+	"strings"
+
+	htgotts "github.com/hegedustibor/htgo-tts"
+)
+
+// online google translate speech, as mp3, which has no speed control
+type google struct {
+	config Config
+}
+
+func (engine *google) Synthesize(text string, options Options) (string, error) {
+	options = engine.config.options(options)
+	options.Speed = 1
+	fileName := engine.config.cached(text, options, ".mp3")
+	if exists(fileName) {
+		return fileName, nil
+	}
+
+	if err := os.MkdirAll(engine.config.Folder, 0770); err != nil {
+		return "", err
+	}
+	speech := htgotts.Speech{Folder: engine.config.Folder, Language: options.Language, Proxy: engine.config.Proxy}
+	name := strings.TrimSuffix(fileName[len(engine.config.Folder)+1:], ".mp3")
+	return speech.CreateSpeechFile(text, name)
+}
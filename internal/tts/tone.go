@@ -0,0 +1,65 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tts
+
+import (
+	"math"
+	"os"
+)
+
+const (
+	toneRate      = 8000
+	toneFrequency = 440
+)
+
+// fake engine, a tone as long as the text would take to speak
+type tone struct {
+	config Config
+}
+
+func (engine *tone) Synthesize(text string, options Options) (string, error) {
+	options = engine.config.options(options)
+	fileName := engine.config.cached(text, options, ".wav")
+	if exists(fileName) {
+		return fileName, nil
+	}
+
+	if err := os.MkdirAll(engine.config.Folder, 0770); err != nil {
+		return "", err
+	}
+	msec := int(float64(len(text)*60) / options.Speed)
+	if msec < 500 {
+		msec = 500
+	} else if msec > 10000 {
+		msec = 10000
+	}
+	samples := make([]int16, toneRate*msec/1000)
+	for pos := range samples {
+		samples[pos] = int16(8000 * math.Sin(2*math.Pi*toneFrequency*float64(pos)/toneRate))
+	}
+	tempName, err := temporary(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempName)
+	if err := WriteWav(tempName, &Audio{Rate: toneRate, Samples: samples}); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tempName, fileName); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
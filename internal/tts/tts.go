@@ -0,0 +1,114 @@
+// Copyright (C) 2023 David Sugar <tychosoft@gmail.com>.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tts
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config selects and configures a speech engine
+type Config struct {
+	Engine   string // google, espeak, piper, flite, or tone
+	Folder   string // cache of synthesized speech files
+	Language string // language code, such as en
+	Voice    string // engine voice, language if empty
+	Model    string // piper voice model file
+	Command  string // synthesizer program, if not the engine default
+	Proxy    string // proxy for google
+}
+
+// Options vary the voice of one synthesis, empty fields use config
+type Options struct {
+	Language string
+	Voice    string  // engine voice
+	Model    string  // piper voice model file
+	Speed    float64 // 1 for normal rate
+}
+
+// Engine synthesizes text into a cached speech file
+type Engine interface {
+	Synthesize(text string, options Options) (string, error)
+}
+
+// New creates the speech engine named in config, google by default
+func New(config Config) (Engine, error) {
+	if len(config.Folder) < 1 {
+		config.Folder = "."
+	}
+	if len(config.Language) < 1 {
+		config.Language = "en"
+	}
+
+	switch strings.ToLower(config.Engine) {
+	case "", "google":
+		return &google{config: config}, nil
+	case "espeak", "espeak-ng":
+		return newEspeak(config), nil
+	case "piper":
+		return newPiper(config)
+	case "flite":
+		return newFlite(config), nil
+	case "tone":
+		return &tone{config: config}, nil
+	}
+	return nil, fmt.Errorf("unknown tts engine %s", config.Engine)
+}
+
+// options with config defaults
+func (config *Config) options(options Options) Options {
+	if len(options.Language) < 1 {
+		options.Language = config.Language
+	}
+	if len(options.Voice) < 1 {
+		options.Voice = config.Voice
+	}
+	if len(options.Model) < 1 {
+		options.Model = config.Model
+	}
+	if options.Speed <= 0 {
+		options.Speed = 1
+	}
+	return options
+}
+
+// cache file name for synthesized text
+func (config *Config) cached(text string, options Options, ext string) string {
+	speed := strconv.FormatFloat(options.Speed, 'f', 2, 64)
+	hash := md5.Sum([]byte(strings.Join([]string{config.Engine, options.Language, options.Voice, speed, options.Model, text}, "\x00")))
+	return config.Folder + "/" + strings.ToLower(config.Engine) + "_" + hex.EncodeToString(hash[:]) + ext
+}
+
+// temporary file beside a cache file, renamed into place once complete
+// so an interrupted synthesis is never cached
+func temporary(fileName string) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(fileName), ".partial-*"+filepath.Ext(fileName))
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+	return file.Name(), nil
+}
+
+func exists(fileName string) bool {
+	info, err := os.Stat(fileName)
+	return err == nil && info.Size() > 0
+}